@@ -0,0 +1,28 @@
+package rolling
+
+import "io"
+
+// Appender is implemented by RollingFileAppender, so that consumers can
+// substitute a mock or another implementation.
+type Appender interface {
+	io.WriteCloser
+	Sync() error
+	Rotate() error
+	// CurrentFilename returns the name of the file being written to,
+	// relative to the log directory.
+	CurrentFilename() string
+}
+
+var _ Appender = (*RollingFileAppender)(nil)
+
+// Discard is an Appender on which all calls succeed without doing
+// anything, for benchmarks and configurations with logging disabled.
+var Discard Appender = discard{}
+
+type discard struct{}
+
+func (discard) Write(p []byte) (int, error) { return len(p), nil }
+func (discard) Sync() error                 { return nil }
+func (discard) Rotate() error               { return nil }
+func (discard) Close() error                { return nil }
+func (discard) CurrentFilename() string     { return "" }
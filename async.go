@@ -0,0 +1,249 @@
+package rolling
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// OverflowPolicy decides what an AsyncWriter does with a write when its
+// queue is full.
+type OverflowPolicy int8
+
+const (
+	// Block waits for room in the queue.
+	Block OverflowPolicy = iota
+	// DropNewest discards the record being written.
+	DropNewest
+	// DropOldest discards the oldest queued record to make room, keeping
+	// the most recent lines, which are usually the most useful ones.
+	DropOldest
+)
+
+const DefaultQueueSize = 1024
+
+type AsyncConfig struct {
+	// QueueSize is the number of records buffered, DefaultQueueSize when
+	// zero.
+	QueueSize int
+	Overflow  OverflowPolicy
+	// OnOverflow is called with every record that is dropped.
+	OnOverflow func(dropped []byte)
+}
+
+// AsyncWriter queues writes and performs them on a background goroutine,
+// so that callers never wait for the disk.
+type AsyncWriter struct {
+	w          io.Writer
+	queue      chan []byte
+	overflow   OverflowPolicy
+	onOverflow func([]byte)
+
+	mu     sync.RWMutex
+	closed bool
+	done   chan struct{}
+	// writeMu serializes the calls to w of the background goroutine and
+	// of WriteUrgent.
+	writeMu sync.Mutex
+
+	pending atomic.Int64
+	flushMu sync.Mutex
+	flushed *sync.Cond
+	dropped atomic.Uint64
+}
+
+func NewAsync(w io.Writer, config AsyncConfig) *AsyncWriter {
+	size := config.QueueSize
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+
+	a := &AsyncWriter{
+		w:          w,
+		queue:      make(chan []byte, size),
+		overflow:   config.Overflow,
+		onOverflow: config.OnOverflow,
+		done:       make(chan struct{}),
+	}
+	a.flushed = sync.NewCond(&a.flushMu)
+
+	go a.run()
+
+	return a
+}
+
+func (a *AsyncWriter) run() {
+	defer close(a.done)
+
+	for p := range a.queue {
+		a.writeMu.Lock()
+		_, err := a.w.Write(p)
+		a.writeMu.Unlock()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+		}
+		a.complete()
+	}
+}
+
+// complete marks a queued record as written or dropped.
+func (a *AsyncWriter) complete() {
+	if a.pending.Add(-1) == 0 {
+		a.flushMu.Lock()
+		a.flushed.Broadcast()
+		a.flushMu.Unlock()
+	}
+}
+
+// Write queues a copy of p. Records dropped by the overflow policy are not
+// reported as errors. Writing to a closed AsyncWriter fails with
+// os.ErrClosed.
+func (a *AsyncWriter) Write(p []byte) (int, error) {
+	return a.WriteContext(context.Background(), p)
+}
+
+// WriteContext is Write, except that with the Block policy it waits for
+// room in the queue only until ctx is done, and then returns ctx.Err()
+// without queuing p.
+func (a *AsyncWriter) WriteContext(ctx context.Context, p []byte) (int, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.closed {
+		return 0, os.ErrClosed
+	}
+
+	record := append([]byte(nil), p...)
+	a.pending.Add(1)
+
+	switch a.overflow {
+	case DropNewest:
+		select {
+		case a.queue <- record:
+		default:
+			a.drop(record)
+		}
+	case DropOldest:
+		for sent := false; !sent; {
+			select {
+			case a.queue <- record:
+				sent = true
+			default:
+				select {
+				case old := <-a.queue:
+					a.drop(old)
+				default:
+				}
+			}
+		}
+	default:
+		select {
+		case a.queue <- record:
+		default:
+			select {
+			case a.queue <- record:
+			case <-ctx.Done():
+				a.complete()
+				return 0, ctx.Err()
+			}
+		}
+	}
+
+	return len(p), nil
+}
+
+// WriteUrgent writes the queued records, then writes p to the underlying
+// writer and syncs it before returning, so that error records survive a
+// crash right after. Records queued meanwhile by other goroutines may get
+// ahead of p, but never interleave with it.
+func (a *AsyncWriter) WriteUrgent(p []byte) (int, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.closed {
+		return 0, os.ErrClosed
+	}
+
+	a.Flush()
+
+	a.writeMu.Lock()
+	defer a.writeMu.Unlock()
+
+	n, err := a.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	if s, ok := a.w.(Syncer); ok {
+		return n, s.Sync()
+	}
+
+	return n, nil
+}
+
+func (a *AsyncWriter) drop(record []byte) {
+	a.dropped.Add(1)
+	if a.onOverflow != nil {
+		a.onOverflow(record)
+	}
+	a.complete()
+}
+
+// Flush waits until every record queued so far has been written.
+func (a *AsyncWriter) Flush() {
+	a.flushMu.Lock()
+	defer a.flushMu.Unlock()
+
+	for a.pending.Load() > 0 {
+		a.flushed.Wait()
+	}
+}
+
+// Sync flushes the queue and syncs the underlying writer if it has a Sync
+// method, as RollingFileAppender does.
+func (a *AsyncWriter) Sync() error {
+	a.Flush()
+
+	if s, ok := a.w.(Syncer); ok {
+		a.writeMu.Lock()
+		defer a.writeMu.Unlock()
+
+		return s.Sync()
+	}
+
+	return nil
+}
+
+// Dropped returns the number of records dropped because the queue was full.
+func (a *AsyncWriter) Dropped() uint64 {
+	return a.dropped.Load()
+}
+
+// Len returns the number of records waiting in the queue.
+func (a *AsyncWriter) Len() int {
+	return len(a.queue)
+}
+
+// Close writes the queued records, stops the background goroutine and
+// closes the underlying writer if it is an io.Closer.
+func (a *AsyncWriter) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return os.ErrClosed
+	}
+	a.closed = true
+	close(a.queue)
+	a.mu.Unlock()
+
+	<-a.done
+
+	if c, ok := a.w.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
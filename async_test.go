@@ -0,0 +1,83 @@
+package rolling_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/importcjj/rolling"
+)
+
+// lineWriter records writes without any locking of its own, as most
+// writers do.
+type lineWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func TestAsyncWriteUrgent(t *testing.T) {
+	w := &lineWriter{}
+	a := rolling.NewAsync(w, rolling.AsyncConfig{QueueSize: 16})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				line := []byte(fmt.Sprintf("%d-%d\n", i, j))
+				var err error
+				if j%10 == 0 {
+					_, err = a.WriteUrgent(line)
+				} else {
+					_, err = a.Write(line)
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(w.buf.String(), "\n"), "\n")
+	if len(lines) != 400 {
+		t.Fatalf("got %d lines, want 400", len(lines))
+	}
+
+	seen := make(map[string]bool)
+	for _, line := range lines {
+		var i, j int
+		if _, err := fmt.Sscanf(line, "%d-%d", &i, &j); err != nil || seen[line] {
+			t.Fatalf("corrupt or repeated line %q", line)
+		}
+		seen[line] = true
+	}
+}
+
+func TestAsyncWriteUrgentAfterQueued(t *testing.T) {
+	w := &lineWriter{}
+	a := rolling.NewAsync(w, rolling.AsyncConfig{})
+	defer a.Close()
+
+	a.Write([]byte("queued\n"))
+	if _, err := a.WriteUrgent([]byte("urgent\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The urgent record is written when WriteUrgent returns, after the one
+	// queued before it.
+	if got := w.buf.String(); got != "queued\nurgent\n" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,91 @@
+package rolling
+
+import (
+	"os"
+	"time"
+)
+
+// WriteAt writes p to the file of the period containing t, for replaying
+// historical records. Past periods are appended to their newest existing
+// file, or to a new file named after the period start. An archived file,
+// or one queued for compression, is never reopened: the records go to the
+// next sequence file, as they do once a file reaches MaxFileSize or
+// MaxLinesPerFile.
+// The file of the last such period is kept open for the following
+// records; once done with, it goes through the same hooks, compression
+// and upload as a rotated file. With Never, AgeRotation or
+// AnchorToFirstWrite, WriteAt is Write.
+func (r *RollingFileAppender) WriteAt(t time.Time, p []byte) (int, error) {
+	rotation, ok := r.state.rotation.(PeriodicRotation)
+	if !ok || r.state.rotation == Never || r.state.anchored {
+		return r.Write(p)
+	}
+	period := rotation.Round(t.In(r.state.location.Load()))
+
+	h := r.file.Load()
+	if h == nil {
+		return 0, os.ErrClosed
+	}
+	current := rotation.Round(h.date).Equal(period)
+
+	if current {
+		return r.Write(p)
+	}
+
+	r.backfillMu.Lock()
+	defer r.backfillMu.Unlock()
+
+	if r.file.Load() == nil {
+		return 0, os.ErrClosed
+	}
+
+	lines := r.state.countLines(p)
+	if r.backfill == nil || !rotation.Round(r.backfill.date).Equal(period) {
+		r.releaseBackfill()
+
+		date, seq, found := r.state.existingPeriodFile(period)
+		if !found {
+			date, seq = period, 0
+		}
+
+		b, err := r.state.createFile(date, seq)
+		if err != nil {
+			return 0, err
+		}
+		r.backfill = b
+	}
+
+	if r.state.full(r.backfill, len(p), lines) {
+		date, seq := r.backfill.date, r.backfill.seq+1
+		r.releaseBackfill()
+
+		b, err := r.state.createFile(date, seq)
+		if err != nil {
+			return 0, err
+		}
+		r.backfill = b
+	}
+	r.backfill.lines.Add(lines)
+
+	n, err := r.writeFile(r.backfill, p)
+	r.mirror(p)
+
+	return n, err
+}
+
+// releaseBackfill closes the backfill file as rotated away from. The
+// caller holds backfillMu.
+func (r *RollingFileAppender) releaseBackfill() {
+	if r.backfill != nil {
+		r.backfill.rotated.Store(true)
+		r.backfill.release()
+		r.backfill = nil
+	}
+}
+
+func (r *RollingFileAppender) closeBackfill() {
+	r.backfillMu.Lock()
+	defer r.backfillMu.Unlock()
+
+	r.releaseBackfill()
+}
@@ -0,0 +1,92 @@
+package rolling_test
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/importcjj/rolling"
+	"github.com/importcjj/rolling/rollingtest"
+)
+
+// waitForFile waits until the named file of f exists.
+func waitForFile(t *testing.T, f *rollingtest.Fixture, name string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(filepath.Join(f.Dir, name)); err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s was not created", name)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func readGzip(t *testing.T, name string) string {
+	t.Helper()
+
+	file, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data)
+}
+
+func TestWriteAtKeepsArchives(t *testing.T) {
+	f := rollingtest.New(t, rolling.Config{
+		Rotation:       rolling.Hourly,
+		FilenameSuffix: ".log",
+		DateFormat:     "2006010215",
+		Compress:       true,
+	})
+	f.Write("hour0-a\n")
+	f.Write("hour0-b\n")
+
+	f.Clock.Advance(time.Hour)
+	f.Write("hour1\n")
+	waitForFile(t, f, "2024010100.log.gz")
+
+	if _, err := f.Appender.WriteAt(rollingtest.Start, []byte("late\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Appender.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readGzip(t, filepath.Join(f.Dir, "2024010100.log.gz")); got != "hour0-a\nhour0-b\n" {
+		t.Errorf("got %q in the archive", got)
+	}
+
+	var late []string
+	for _, name := range f.Files() {
+		if strings.HasPrefix(name, "2024010100") && name != "2024010100.log.gz" {
+			late = append(late, name)
+		}
+	}
+	if len(late) != 1 {
+		t.Fatalf("got backfilled files %q, want one", late)
+	}
+	if got := readGzip(t, filepath.Join(f.Dir, late[0])); got != "late\n" {
+		t.Errorf("got %q in %s", got, late[0])
+	}
+}
@@ -0,0 +1,29 @@
+//go:build !rolling_minimal
+// +build !rolling_minimal
+
+package rolling
+
+import (
+	"time"
+
+	"github.com/djherbis/times"
+)
+
+// birthTimes reports whether files are ordered by birth time unless
+// DisableBirthTime is set. The rolling_minimal build tag leaves out the
+// times dependency and birth times with it.
+const birthTimes = true
+
+// birthTime returns the birth time of the file name, if it has one.
+func birthTime(name string) (time.Time, bool, error) {
+	t, err := times.Stat(name)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	if !t.HasBirthTime() {
+		return time.Time{}, false, nil
+	}
+
+	return t.BirthTime(), true, nil
+}
@@ -0,0 +1,12 @@
+//go:build rolling_minimal
+// +build rolling_minimal
+
+package rolling
+
+import "time"
+
+const birthTimes = false
+
+func birthTime(name string) (time.Time, bool, error) {
+	return time.Time{}, false, nil
+}
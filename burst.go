@@ -0,0 +1,133 @@
+package rolling
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const DefaultBurstInterval = time.Second
+
+// burstLimiter caps the bytes written per interval for
+// MaxBytesPerInterval.
+type burstLimiter struct {
+	max      int64
+	interval time.Duration
+
+	// emit writes the summary of an interval that suppressed records when
+	// it ends, from timer, should no write follow the storm.
+	emit func(summary []byte)
+
+	mu         sync.Mutex
+	start      time.Time
+	written    int64
+	suppressed int64
+	lines      int64
+	timer      *time.Timer
+}
+
+// admit reports whether p fits in the budget of the interval containing
+// now. At the first write of an interval after one that suppressed
+// records, it also returns the summary line to write first, unless the
+// timer has written it already.
+func (b *burstLimiter) admit(now time.Time, p []byte) ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var summary []byte
+	if start := now.Truncate(b.interval); !start.Equal(b.start) {
+		summary = b.take()
+		b.start, b.written = start, 0
+	}
+
+	if b.written+int64(len(p)) > b.max {
+		if b.suppressed == 0 && b.emit != nil {
+			start := b.start
+			b.timer = time.AfterFunc(start.Add(b.interval).Sub(now), func() {
+				b.expire(start)
+			})
+		}
+		b.suppressed += int64(len(p))
+		b.lines += int64(bytes.Count(p, newline))
+		return summary, false
+	}
+	b.written += int64(len(p))
+
+	return summary, true
+}
+
+// take returns the summary of the records suppressed so far, if any, and
+// starts counting again. The caller holds mu.
+func (b *burstLimiter) take() []byte {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if b.suppressed == 0 {
+		return nil
+	}
+
+	summary := []byte(fmt.Sprintf("rolling: suppressed %d bytes / %d lines since %s\n",
+		b.suppressed, b.lines, b.start.Format(time.RFC3339)))
+	b.suppressed, b.lines = 0, 0
+
+	return summary
+}
+
+// expire writes the summary of the interval beginning at start, which has
+// ended, unless a write in the next interval has taken it.
+func (b *burstLimiter) expire(start time.Time) {
+	b.mu.Lock()
+	var summary []byte
+	if b.start.Equal(start) {
+		summary = b.take()
+	}
+	b.mu.Unlock()
+
+	if summary != nil {
+		b.emit(summary)
+	}
+}
+
+// flush returns the summary of the records suppressed so far, for Close.
+func (b *burstLimiter) flush() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.take()
+}
+
+// limitBurst reports whether p may be written with MaxBytesPerInterval,
+// writing the summary of a previous storm first. Suppressed records are
+// reported as written. The caller is between beginWrite and endWrite.
+func (r *RollingFileAppender) limitBurst(p []byte) bool {
+	if r.state.burst == nil {
+		return true
+	}
+
+	summary, ok := r.state.burst.admit(r.state.getNow(), p)
+	if summary != nil {
+		r.writeBurstSummary(summary)
+	}
+
+	return ok
+}
+
+// emitBurstSummary writes the summary of a storm at the end of its
+// interval.
+func (r *RollingFileAppender) emitBurstSummary(summary []byte) {
+	r.beginWrite()
+	defer r.endWrite()
+
+	r.writeBurstSummary(summary)
+}
+
+func (r *RollingFileAppender) writeBurstSummary(summary []byte) {
+	if h := r.acquireFileFor(len(summary), 1); h != nil {
+		if _, err := r.writeFile(h, summary); err != nil {
+			r.state.logError("failed to write the burst summary", err)
+		}
+		h.release()
+	}
+}
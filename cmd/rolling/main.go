@@ -0,0 +1,178 @@
+// Command rolling inspects and maintains directories of rolling log files
+// using the same matching and retention logic as the library.
+//
+// Usage:
+//
+//	rolling [flags] list|prune|compress|verify
+package main
+
+import (
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/importcjj/rolling"
+)
+
+func main() {
+	var config rolling.Config
+	var maxFiles uint
+	var rotation string
+	flag.StringVar(&config.Directory, "dir", "", "log directory (default: working directory)")
+	flag.StringVar(&config.FilenamePrefix, "prefix", "", "log filename prefix")
+	flag.StringVar(&config.FilenameSuffix, "suffix", "", "log filename suffix")
+	flag.StringVar(&config.DateFormat, "date-format", rolling.DefaultDateFormat, "date layout used in filenames")
+	flag.StringVar(&rotation, "rotation", "daily", "rotation the files are named for, as in \"hourly\" or \"never\"")
+	flag.UintVar(&maxFiles, "max-files", 0, "number of files kept by prune")
+	flag.BoolVar(&config.DisableBirthTime, "by-name", false, "order files by the dates in their names rather than their birth times")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: rolling [flags] list|prune|compress|verify\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	config.MaxFiles = uint32(maxFiles)
+
+	var err error
+	if config.Rotation, err = rolling.ParseRotation(rotation); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	switch flag.Arg(0) {
+	case "list":
+		err = list(config)
+	case "prune":
+		err = prune(config)
+	case "compress":
+		err = compress(config)
+	case "verify":
+		err = verify(config)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "rolling:", err)
+		os.Exit(1)
+	}
+}
+
+func list(config rolling.Config) error {
+	names, err := rolling.ListFiles(config)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		fmt.Println(name)
+	}
+
+	return nil
+}
+
+func prune(config rolling.Config) error {
+	if config.MaxFiles == 0 {
+		return fmt.Errorf("prune requires -max-files")
+	}
+
+	removed, err := rolling.PruneFiles(config)
+	for _, name := range removed {
+		fmt.Println("removed", name)
+	}
+
+	return err
+}
+
+// compress gzips every log file but the newest one, which may still be
+// written to.
+func compress(config rolling.Config) error {
+	names, err := rolling.ListFiles(config)
+	if err != nil {
+		return err
+	}
+
+	for i, name := range names {
+		if i == len(names)-1 || strings.HasSuffix(name, ".gz") {
+			continue
+		}
+
+		if err := rolling.CompressFile(path.Join(directory(config), name), config); err != nil {
+			return err
+		}
+		fmt.Println("compressed", name)
+	}
+
+	return nil
+}
+
+// verify checks that every log file is named after the configured date
+// format and can be read to the end. Finding no file at all fails too, as
+// a wrong -date-format or a file system without birth times would.
+func verify(config rolling.Config) error {
+	names, err := rolling.ListFiles(config)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no log files found in %s; check -prefix, -suffix and -date-format, or -by-name where files have no birth time", directory(config))
+	}
+
+	var failed int
+	for _, name := range names {
+		if err := verifyFile(config, name); err != nil {
+			fmt.Printf("FAIL %s: %v\n", name, err)
+			failed++
+			continue
+		}
+		fmt.Printf("ok   %s\n", name)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed verification", failed, len(names))
+	}
+
+	return nil
+}
+
+func verifyFile(config rolling.Config, name string) error {
+	if _, _, ok := rolling.ParseFilename(name, config); !ok {
+		return fmt.Errorf("unexpected name")
+	}
+
+	file, err := os.Open(path.Join(directory(config), name))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if strings.HasSuffix(name, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		r = gz
+	}
+
+	_, err = io.Copy(io.Discard, r)
+	return err
+}
+
+func directory(config rolling.Config) string {
+	if config.Directory == "" {
+		return "."
+	}
+
+	return config.Directory
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// binary is the command built for the tests.
+var binary string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "rolling")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	binary = filepath.Join(dir, "rolling")
+	if out, err := exec.Command("go", "build", "-o", binary, ".").CombinedOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "go build: %v\n%s", err, out)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// logDir creates a directory holding the named files with content.
+func logDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+// run runs the command on dir and returns its output and exit status.
+func run(t *testing.T, dir string, args ...string) (string, int) {
+	t.Helper()
+
+	args = append([]string{"-dir", dir, "-prefix", "app.", "-suffix", ".log", "-date-format", "20060102", "-by-name"}, args...)
+	var out bytes.Buffer
+	cmd := exec.Command(binary, args...)
+	cmd.Stdout, cmd.Stderr = &out, &out
+
+	err := cmd.Run()
+	var exit *exec.ExitError
+	switch {
+	case err == nil:
+		return out.String(), 0
+	case errors.As(err, &exit):
+		return out.String(), exit.ExitCode()
+	}
+	t.Fatal(err)
+
+	return "", 0
+}
+
+var dailyFiles = map[string]string{
+	"app.20240103.log": "third\n",
+	"app.20240101.log": "first\n",
+	"app.20240102.log": "second\n",
+	"other.log":        "not a log of app\n",
+}
+
+func TestList(t *testing.T) {
+	out, code := run(t, logDir(t, dailyFiles), "list")
+	if want := "app.20240101.log\napp.20240102.log\napp.20240103.log\n"; code != 0 || out != want {
+		t.Errorf("got %d and %q, want %q", code, out, want)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir := logDir(t, dailyFiles)
+
+	out, code := run(t, dir, "-max-files", "1", "prune")
+	if want := "removed app.20240101.log\nremoved app.20240102.log\n"; code != 0 || out != want {
+		t.Errorf("got %d and %q, want %q", code, out, want)
+	}
+
+	removed := map[string]bool{"app.20240101.log": true, "app.20240102.log": true}
+	for name := range dailyFiles {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if gone := errors.Is(err, os.ErrNotExist); gone != removed[name] {
+			t.Errorf("%s: removed %t", name, gone)
+		}
+	}
+
+	if _, code := run(t, dir, "prune"); code != 1 {
+		t.Errorf("got exit status %d for prune without -max-files", code)
+	}
+}
+
+func TestCompressAndVerify(t *testing.T) {
+	dir := logDir(t, dailyFiles)
+
+	out, code := run(t, dir, "compress")
+	if want := "compressed app.20240101.log\ncompressed app.20240102.log\n"; code != 0 || out != want {
+		t.Errorf("got %d and %q, want %q", code, out, want)
+	}
+	for _, name := range []string{"app.20240101.log.gz", "app.20240102.log.gz", "app.20240103.log"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	out, code = run(t, dir, "verify")
+	if want := "ok   app.20240101.log.gz\nok   app.20240102.log.gz\nok   app.20240103.log\n"; code != 0 || out != want {
+		t.Errorf("got %d and %q, want %q", code, out, want)
+	}
+}
+
+func TestVerifyFailures(t *testing.T) {
+	dir := logDir(t, map[string]string{
+		"app.20240101.log":    "first\n",
+		"app.20240102.log.gz": "not gzip",
+		"app.yesterday.log":   "misnamed\n",
+	})
+
+	out, code := run(t, dir, "verify")
+	if code != 1 {
+		t.Errorf("got exit status %d", code)
+	}
+	for _, want := range []string{"ok   app.20240101.log", "FAIL app.20240102.log.gz", "FAIL app.yesterday.log: unexpected name", "2 of 3 files failed"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in %q", want, out)
+		}
+	}
+}
+
+func TestVerifyNoFiles(t *testing.T) {
+	for _, dir := range []string{t.TempDir(), logDir(t, map[string]string{"other.log": "not a log of app\n"})} {
+		out, code := run(t, dir, "verify")
+		if code != 1 || !strings.Contains(out, "no log files found") {
+			t.Errorf("got %d and %q", code, out)
+		}
+	}
+}
+
+func TestUsage(t *testing.T) {
+	if _, code := run(t, t.TempDir(), "frobnicate"); code != 2 {
+		t.Errorf("got exit status %d for an unknown command", code)
+	}
+	if _, code := run(t, t.TempDir(), "-rotation", "fortnightly", "list"); code != 2 {
+		t.Errorf("got exit status %d for an unknown rotation", code)
+	}
+}
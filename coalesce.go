@@ -0,0 +1,125 @@
+package rolling
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// combiner coalesces concurrent writes to a file: while one writer is in
+// the write call the others queue their records, and the next writer
+// writes all of them with a single call.
+type combiner struct {
+	mu      sync.Mutex
+	writing bool
+	queue   []*writeRequest
+	buf     bytes.Buffer
+}
+
+type writeRequest struct {
+	p    []byte
+	n    int
+	err  error
+	lead bool
+	done chan struct{}
+}
+
+var writeRequestPool = sync.Pool{
+	New: func() interface{} {
+		return &writeRequest{done: make(chan struct{}, 1)}
+	},
+}
+
+func (h *fileHandle) coalescedWrite(p []byte) (int, error) {
+	c := &h.combiner
+
+	c.mu.Lock()
+	if !c.writing {
+		c.writing = true
+		c.mu.Unlock()
+		return c.lead(h, p)
+	}
+
+	req := writeRequestPool.Get().(*writeRequest)
+	req.p = p
+	c.queue = append(c.queue, req)
+	c.mu.Unlock()
+
+	<-req.done
+	n, err, lead := req.n, req.err, req.lead
+	*req = writeRequest{done: req.done}
+	writeRequestPool.Put(req)
+
+	if lead {
+		return c.lead(h, p)
+	}
+
+	return n, err
+}
+
+// lead writes p along with the queued records, then hands over to the
+// first writer that queued in the meantime, so that no writer performs
+// more than one batch.
+func (c *combiner) lead(h *fileHandle, p []byte) (int, error) {
+	c.mu.Lock()
+	batch := c.queue
+	c.queue = nil
+	c.mu.Unlock()
+
+	if len(batch) == 0 {
+		n, err := h.Write(p)
+		c.handOver()
+		return n, err
+	}
+
+	c.buf.Reset()
+	c.buf.Write(p)
+	for _, req := range batch {
+		c.buf.Write(req.p)
+	}
+
+	written, err := h.Write(c.buf.Bytes())
+	n, err := splitWritten(&written, len(p), err)
+	for _, req := range batch {
+		req.n, req.err = splitWritten(&written, len(req.p), err)
+		req.done <- struct{}{}
+	}
+
+	c.handOver()
+
+	return n, err
+}
+
+func (c *combiner) handOver() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.queue) == 0 {
+		c.writing = false
+		return
+	}
+
+	next := c.queue[0]
+	c.queue = c.queue[1:]
+	next.lead = true
+	next.done <- struct{}{}
+}
+
+// splitWritten takes the share of a record of size bytes from the bytes
+// written by a coalesced write.
+func splitWritten(written *int, size int, err error) (int, error) {
+	n := size
+	if *written < n {
+		n = *written
+	}
+	*written -= n
+
+	if n == size {
+		return n, nil
+	}
+	if err == nil {
+		err = io.ErrShortWrite
+	}
+
+	return n, err
+}
@@ -0,0 +1,232 @@
+package rolling
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// compressor gzips rotated files in the background on a fixed number of
+// workers, starting at most one file per interval. An appender has one of
+// its own, while a DirectoryManager shares one among its appenders so that
+// their rotations at the same boundary do not compress dozens of files at
+// once.
+type compressor struct {
+	workers  int
+	interval time.Duration
+
+	once   sync.Once
+	mu     sync.Mutex
+	queue  []compressJob
+	wake   chan struct{}
+	next   time.Time
+	closed bool
+	// pending counts the files queued or being compressed, and names
+	// holds their paths.
+	pending int
+	names   map[string]bool
+	idle    *sync.Cond
+}
+
+type compressJob struct {
+	s    *state
+	name string
+}
+
+func newCompressor(workers int, interval time.Duration) *compressor {
+	if workers <= 0 {
+		workers = 1
+	}
+
+	c := &compressor{workers: workers, interval: interval, wake: make(chan struct{}, 1), names: make(map[string]bool)}
+	c.idle = sync.NewCond(&c.mu)
+
+	return c
+}
+
+func (c *compressor) enqueue(s *state, name string) {
+	c.once.Do(func() {
+		for i := 0; i < c.workers; i++ {
+			go c.run()
+		}
+	})
+
+	c.mu.Lock()
+	if c.closed {
+		// A write still in flight at Close released the file late.
+		c.mu.Unlock()
+		s.compressFile(name)
+		return
+	}
+	c.pending++
+	c.names[path.Join(s.logDirectory, name)] = true
+	c.queue = append(c.queue, compressJob{s, name})
+	c.mu.Unlock()
+
+	c.signal()
+}
+
+// queued reports whether the file name of s is queued or being compressed.
+func (c *compressor) queued(s *state, name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.names[path.Join(s.logDirectory, name)]
+}
+
+// signal wakes up a worker, which passes it on to the next one.
+func (c *compressor) signal() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// close waits until every queued file has been compressed and stops the
+// workers.
+func (c *compressor) close() {
+	c.mu.Lock()
+	for c.pending > 0 {
+		c.idle.Wait()
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	c.signal()
+}
+
+func (c *compressor) run() {
+	for range c.wake {
+		for {
+			job, ok := c.take()
+			if !ok {
+				break
+			}
+			c.signal()
+
+			job.s.compressFile(job.name)
+
+			c.mu.Lock()
+			delete(c.names, path.Join(job.s.logDirectory, job.name))
+			if c.pending--; c.pending == 0 {
+				c.idle.Broadcast()
+			}
+			c.mu.Unlock()
+		}
+
+		c.mu.Lock()
+		closed := c.closed
+		c.mu.Unlock()
+		if closed {
+			c.signal()
+			return
+		}
+	}
+}
+
+// take returns the next job once the rate limit allows it.
+func (c *compressor) take() (compressJob, bool) {
+	c.mu.Lock()
+	if len(c.queue) == 0 {
+		c.mu.Unlock()
+		return compressJob{}, false
+	}
+	job := c.queue[0]
+	c.queue = c.queue[1:]
+
+	now := time.Now()
+	start := c.next
+	if start.Before(now) {
+		start = now
+	}
+	c.next = start.Add(c.interval)
+	c.mu.Unlock()
+
+	time.Sleep(time.Until(start))
+
+	return job, true
+}
+
+// compressFile replaces the rotated file name with a gzipped copy, written
+// under a ".gz.partial" name first so that a crash never leaves a
+// truncated archive behind.
+func (s *state) compressFile(name string) {
+	full := path.Join(s.logDirectory, name)
+	if err := gzipFile(full, s.fileMode); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			// Pruned while queued.
+			return
+		}
+		s.logError("failed to compress the log file", err, "file", name)
+		return
+	}
+	s.indexRemoved(name, name+".gz")
+	s.refreshEntry(name + ".gz")
+
+	if s.metadata == MetadataSidecar {
+		if err := os.Rename(full+metadataExt, full+".gz"+metadataExt); err != nil && !os.IsNotExist(err) {
+			s.logError("failed to rename the log file metadata", err, "file", name)
+		}
+	}
+
+	if s.syncDir {
+		if err := syncDir(path.Dir(full)); err != nil {
+			s.logError("failed to sync the log directory", err)
+		}
+	}
+	s.logEvent("compressed the log file", "file", name)
+}
+
+// CompressFile gzips the log file at path name as the appender does with
+// Compress, for tools maintaining log directories: the archive gets the
+// FileMode of config and is written under a ".gz.partial" name first, then
+// replaces the file.
+func CompressFile(name string, config Config) error {
+	mode := config.FileMode
+	if mode == 0 {
+		mode = DefaultFileMode
+	}
+
+	return gzipFile(name, mode)
+}
+
+func gzipFile(name string, mode os.FileMode) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	partial := name + partialExt
+	dst, err := os.OpenFile(partial, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	// As for the log files, the mode does not depend on the umask, where
+	// the filesystem supports it.
+	dst.Chmod(mode)
+
+	gz := gzip.NewWriter(dst)
+	_, err = io.Copy(gz, src)
+	if cerr := gz.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(partial)
+		return err
+	}
+
+	if err := os.Rename(partial, name+".gz"); err != nil {
+		return err
+	}
+
+	return os.Remove(name)
+}
@@ -0,0 +1,296 @@
+package rolling_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/importcjj/rolling"
+	"github.com/importcjj/rolling/rollingtest"
+)
+
+// openFiles is an OpenFileFunc keeping the files it opened, to check that
+// the appender closes them.
+type openFiles struct {
+	mu    sync.Mutex
+	files []*os.File
+}
+
+func (o *openFiles) open(name string, flag int, perm os.FileMode) (*os.File, error) {
+	file, err := os.OpenFile(name, flag, perm)
+	if err == nil {
+		o.mu.Lock()
+		o.files = append(o.files, file)
+		o.mu.Unlock()
+	}
+
+	return file, err
+}
+
+// stillOpen returns the names of the files not closed yet.
+func (o *openFiles) stillOpen() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var names []string
+	for _, file := range o.files {
+		if _, err := file.Stat(); !errors.Is(err, os.ErrClosed) {
+			names = append(names, file.Name())
+		}
+	}
+
+	return names
+}
+
+// records returns the lines of all files of f, and the file of each.
+func records(t *testing.T, f *rollingtest.Fixture) map[string][]string {
+	t.Helper()
+
+	found := make(map[string][]string)
+	for _, name := range f.Files() {
+		for _, line := range strings.Split(f.Read(name), "\n") {
+			if line != "" {
+				found[line] = append(found[line], name)
+			}
+		}
+	}
+
+	return found
+}
+
+func TestConcurrentWritesAcrossRotations(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		config rolling.Config
+	}{
+		{"time", rolling.Config{Rotation: rolling.Hourly}},
+		{"size", rolling.Config{Rotation: rolling.Hourly, MaxFileSize: 512}},
+		{"strict", rolling.Config{Rotation: rolling.Hourly, StrictRotation: true}},
+		{"coalesce", rolling.Config{Rotation: rolling.Hourly, CoalesceWrites: true}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			const writers, writes = 8, 200
+
+			f := rollingtest.New(t, tt.config)
+
+			var wg sync.WaitGroup
+			for i := 0; i < writers; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					for j := 0; j < writes; j++ {
+						if _, err := fmt.Fprintf(f.Appender, "%d-%d\n", i, j); err != nil {
+							t.Error(err)
+							return
+						}
+					}
+				}(i)
+			}
+
+			done := make(chan struct{})
+			go func() {
+				wg.Wait()
+				close(done)
+			}()
+			for rotating := true; rotating; {
+				select {
+				case <-done:
+					rotating = false
+				default:
+					f.Clock.Advance(time.Hour)
+					time.Sleep(time.Millisecond)
+				}
+			}
+
+			if err := f.Appender.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			found := records(t, f)
+			if len(found) != writers*writes {
+				t.Errorf("got %d records, want %d", len(found), writers*writes)
+			}
+			for record, files := range found {
+				if len(files) != 1 {
+					t.Errorf("record %s written to %q", record, files)
+				}
+			}
+			if len(f.Rotations()) == 0 {
+				t.Error("no rotation happened")
+			}
+		})
+	}
+}
+
+func TestCloseWithWritesInFlight(t *testing.T) {
+	files := &openFiles{}
+	f := rollingtest.New(t, rolling.Config{
+		Rotation:     rolling.Hourly,
+		MaxFileSize:  256,
+		OpenFileFunc: files.open,
+	})
+
+	var written atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; ; j++ {
+				if _, err := fmt.Fprintf(f.Appender, "%d-%d\n", i, j); err != nil {
+					if !errors.Is(err, os.ErrClosed) {
+						t.Error(err)
+					}
+					return
+				}
+				written.Add(1)
+			}
+		}(i)
+	}
+
+	for written.Load() < 1000 {
+		time.Sleep(time.Millisecond)
+	}
+
+	closed := make(chan error)
+	go func() { closed <- f.Appender.Close() }()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return")
+	}
+	wg.Wait()
+
+	if open := files.stillOpen(); len(open) > 0 {
+		t.Errorf("files left open: %q", open)
+	}
+	if got := len(records(t, f)); int64(got) != written.Load() {
+		t.Errorf("got %d records, want %d", got, written.Load())
+	}
+}
+
+// TestStrictRotationWaitsForWrites holds a write that started before a
+// boundary in the middle of opening its file, and checks that a write
+// after the boundary lets it finish in the file of its period first. The
+// write is held by a DirectoryManager reopening the appender's parked
+// file.
+func TestStrictRotationWaitsForWrites(t *testing.T) {
+	dir := t.TempDir()
+	clock := rollingtest.NewClock(rollingtest.Start)
+
+	entered := make(chan struct{})
+	proceed := make(chan struct{})
+	var hold atomic.Bool
+	open := func(name string, flag int, perm os.FileMode) (*os.File, error) {
+		if hold.CompareAndSwap(true, false) {
+			close(entered)
+			<-proceed
+		}
+		return os.OpenFile(name, flag, perm)
+	}
+
+	m := rolling.NewDirectoryManager(dir, 0)
+	m.MaxOpenFiles = 1
+	config := rolling.Config{
+		Rotation:         rolling.Hourly,
+		FilenamePrefix:   "strict.",
+		DateFormat:       "2006010215",
+		Clock:            clock,
+		DisableBirthTime: true,
+		StrictRotation:   true,
+		OpenFileFunc:     open,
+	}
+	a, err := m.New(config, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	// Opening the file of another appender parks a's.
+	config.FilenamePrefix, config.OpenFileFunc = "other.", nil
+	other, err := m.New(config, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	hold.Store(true)
+	before := make(chan error)
+	go func() {
+		_, err := a.Write([]byte("before\n"))
+		before <- err
+	}()
+	<-entered
+
+	clock.Advance(time.Hour)
+	after := make(chan error)
+	go func() {
+		_, err := a.Write([]byte("after\n"))
+		after <- err
+	}()
+
+	select {
+	case <-after:
+		t.Fatal("the write after the boundary did not wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(proceed)
+
+	for _, done := range []chan error{before, after} {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, want := range map[string]string{"strict.2024010100": "before\n", "strict.2024010101": "after\n"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(data); got != want {
+			t.Errorf("got %q in %s, want %q", got, name, want)
+		}
+	}
+}
+
+// TestWritersCrossingBoundary starts writers together after a boundary:
+// none of them may write to the old file while another swaps it.
+func TestWritersCrossingBoundary(t *testing.T) {
+	f := rollingtest.New(t, rolling.Config{Rotation: rolling.Hourly})
+	f.Write("old\n")
+	old := f.Files()[0]
+
+	f.Clock.Advance(time.Hour)
+
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			if _, err := fmt.Fprintf(f.Appender, "new-%d\n", i); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	if got := f.Read(old); got != "old\n" {
+		t.Errorf("got %q in the file of the previous period", got)
+	}
+	if got := len(f.Rotations()); got != 1 {
+		t.Errorf("got %d rotations, want 1", got)
+	}
+	f.AssertFileCount(2)
+}
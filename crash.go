@@ -0,0 +1,45 @@
+package rolling
+
+import (
+	"errors"
+	"fmt"
+)
+
+type CrashOutput int8
+
+const (
+	CrashOutputOff CrashOutput = iota
+	// CrashOutputLog writes crash output to the current log file.
+	CrashOutputLog
+	// CrashOutputFile writes crash output to a dedicated file named after
+	// the prefix and suffix, as in "app-crash.log", which is never pruned.
+	CrashOutputFile
+)
+
+var ErrCrashOutputUnsupported = errors.New("rolling: crash output requires Go 1.23 or later")
+
+func (s *state) crashFilename() string {
+	return s.logFilenamePrefix + "crash" + s.logFilenameSuffix
+}
+
+func (r *RollingFileAppender) setupCrashOutput(h *fileHandle) error {
+	switch r.state.crashOutput {
+	case CrashOutputLog:
+		return setCrashOutput(h.file)
+
+	case CrashOutputFile:
+		file, err := r.state.openLogFile(r.state.crashFilename(), 0)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		// The runtime keeps its own duplicate of the descriptor.
+		return setCrashOutput(file)
+
+	case CrashOutputOff:
+		return nil
+	}
+
+	return fmt.Errorf("rolling: invalid CrashOutput %d", r.state.crashOutput)
+}
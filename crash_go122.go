@@ -0,0 +1,10 @@
+//go:build !go1.23
+// +build !go1.23
+
+package rolling
+
+import "os"
+
+func setCrashOutput(file *os.File) error {
+	return ErrCrashOutputUnsupported
+}
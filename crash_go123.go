@@ -0,0 +1,12 @@
+//go:build go1.23
+
+package rolling
+
+import (
+	"os"
+	"runtime/debug"
+)
+
+func setCrashOutput(file *os.File) error {
+	return debug.SetCrashOutput(file, debug.CrashOptions{})
+}
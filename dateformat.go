@@ -0,0 +1,223 @@
+package rolling
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// formatDate formats date with a time.Format layout extended with the
+// strftime-style %G (ISO year) and %V (ISO week) verbs, which time.Format
+// does not provide.
+func formatDate(date time.Time, layout string) string {
+	if !strings.Contains(layout, "%") {
+		return date.Format(layout)
+	}
+
+	var b strings.Builder
+	for len(layout) > 0 {
+		i := strings.Index(layout, "%")
+		if i < 0 || i == len(layout)-1 {
+			b.WriteString(date.Format(layout))
+			break
+		}
+
+		if i > 0 {
+			b.WriteString(date.Format(layout[:i]))
+		}
+
+		year, week := date.ISOWeek()
+		switch layout[i+1] {
+		case 'G':
+			fmt.Fprintf(&b, "%04d", year)
+		case 'V':
+			fmt.Fprintf(&b, "%02d", week)
+		default:
+			b.WriteString(layout[i : i+2])
+		}
+		layout = layout[i+2:]
+	}
+
+	return b.String()
+}
+
+var errBadDate = errors.New("rolling: date does not match the layout")
+
+// parseDate is the inverse of formatDate. Layouts with %G or %V may only
+// contain literal text besides them.
+func parseDate(layout, value string, loc *time.Location) (time.Time, error) {
+	if !strings.Contains(layout, "%") {
+		return time.ParseInLocation(layout, value, loc)
+	}
+
+	year, week := -1, -1
+	for len(layout) > 0 {
+		i := strings.Index(layout, "%")
+		if i < 0 || i == len(layout)-1 {
+			i = len(layout)
+		}
+
+		literal := layout[:i]
+		if (time.Time{}).Format(literal) != literal {
+			return time.Time{}, fmt.Errorf("rolling: cannot parse layout %q", layout)
+		}
+		if !strings.HasPrefix(value, literal) {
+			return time.Time{}, errBadDate
+		}
+		value = value[len(literal):]
+
+		if i == len(layout) {
+			break
+		}
+
+		var width int
+		switch layout[i+1] {
+		case 'G':
+			width = 4
+		case 'V':
+			width = 2
+		default:
+			return time.Time{}, fmt.Errorf("rolling: cannot parse layout %q", layout)
+		}
+
+		if len(value) < width {
+			return time.Time{}, errBadDate
+		}
+		n, err := strconv.Atoi(value[:width])
+		if err != nil {
+			return time.Time{}, errBadDate
+		}
+		value = value[width:]
+
+		if layout[i+1] == 'G' {
+			year = n
+		} else {
+			week = n
+		}
+		layout = layout[i+2:]
+	}
+
+	if len(value) > 0 || year < 0 {
+		return time.Time{}, errBadDate
+	}
+	if week < 0 {
+		week = 1
+	}
+
+	// January 4th is always in the first ISO week.
+	jan4 := time.Date(year, 1, 4, 0, 0, 0, 0, loc)
+	monday := jan4.AddDate(0, 0, -((int(jan4.Weekday())+6)%7)+(week-1)*7)
+
+	return monday, nil
+}
+
+// collides reports whether layout gives the same name to two different
+// periods of rotation, probed around a year boundary at distances from a
+// nanosecond to several years.
+func collides(rotation PeriodicRotation, layout string, loc *time.Location) bool {
+	base := time.Date(2023, 12, 31, 23, 59, 59, 999999999, loc)
+	offsets := []time.Duration{
+		0, 1, time.Microsecond, time.Millisecond, time.Second, time.Minute,
+		time.Hour, 24 * time.Hour, 7 * 24 * time.Hour, 31 * 24 * time.Hour,
+		366 * 24 * time.Hour, 4 * 366 * 24 * time.Hour,
+	}
+	if r, ok := rotation.(interface{ Period() time.Duration }); ok && r.Period() > 0 {
+		for k := 1; k <= 3; k++ {
+			offsets = append(offsets, time.Duration(k)*r.Period())
+		}
+	}
+
+	names := make(map[string]time.Time, len(offsets))
+	for _, offset := range offsets {
+		start := rotation.Round(base.Add(offset))
+		name := formatDate(start, layout)
+		if other, ok := names[name]; ok && !other.Equal(start) {
+			return true
+		}
+		names[name] = start
+	}
+
+	return false
+}
+
+// dateLayoutParts are appended to a colliding layout by ExtendDateFormat.
+var dateLayoutParts = []string{"2006", "01", "02", "15", "04", "05", ".000", ".000000", ".000000000"}
+
+// extendDateFormat returns layout with the shortest run of dateLayoutParts
+// appended that tells the periods of rotation apart.
+func extendDateFormat(rotation PeriodicRotation, layout string, loc *time.Location) (string, bool) {
+	for n := 1; n <= len(dateLayoutParts); n++ {
+		for i := 0; i+n <= len(dateLayoutParts); i++ {
+			extended := layout + "." + strings.TrimPrefix(strings.Join(dateLayoutParts[i:i+n], ""), ".")
+			if !collides(rotation, extended, loc) {
+				return extended, true
+			}
+		}
+	}
+
+	return layout, false
+}
+
+// sortBases are times at which fields roll over, e.g. from one digit to
+// two, or from December to January. ValidateDateFormat checks the names of
+// each of them against those of the times sortSteps later.
+var (
+	sortBases = []time.Time{
+		time.Date(2009, 9, 9, 9, 9, 9, 999000000, time.UTC),
+		time.Date(2009, 1, 31, 11, 59, 59, 999000000, time.UTC),
+		time.Date(2009, 12, 31, 23, 59, 59, 999000000, time.UTC),
+		time.Date(2010, 2, 28, 12, 59, 59, 999000000, time.UTC),
+		time.Date(999, 12, 31, 23, 59, 59, 999000000, time.UTC),
+	}
+	sortSteps = []time.Duration{
+		time.Millisecond, time.Second, time.Minute, time.Hour, 24 * time.Hour,
+		7 * 24 * time.Hour, 31 * 24 * time.Hour, 366 * 24 * time.Hour,
+	}
+)
+
+// ValidateDateFormat reports ErrDateFormatUnsortable when the names layout
+// gives to successive times do not sort in time order, as of fields that
+// are not zero padded, e.g. "2-1-2006", or not from most to least
+// significant, so that ls and shell globs would list files out of order.
+// The dates are compared in UTC.
+func ValidateDateFormat(layout string) error {
+	for _, base := range sortBases {
+		for _, step := range sortSteps {
+			earlier, later := formatDate(base, layout), formatDate(base.Add(step), layout)
+			if earlier > later {
+				return fmt.Errorf("%w: %q names %v %q and %v %q", ErrDateFormatUnsortable,
+					layout, base.Format(time.RFC3339), earlier, base.Add(step).Format(time.RFC3339), later)
+			}
+		}
+	}
+
+	return nil
+}
+
+// formatName formats the date of a file name with layout, in UTC with
+// UTCFilenames.
+func (s *state) formatName(date time.Time, layout string) string {
+	if s.utcNames {
+		date = date.UTC()
+	}
+
+	return formatDate(date, layout)
+}
+
+// parseName parses the date of a file name formatted by formatName, and
+// returns it in TimeLocation.
+func (s *state) parseName(layout, value string) (time.Time, error) {
+	loc := s.location.Load()
+	if s.utcNames {
+		loc = time.UTC
+	}
+
+	date, err := parseDate(layout, value, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return date.In(s.location.Load()), nil
+}
@@ -0,0 +1,141 @@
+package rolling
+
+import (
+	"os"
+	"sync"
+	"unsafe"
+)
+
+const (
+	directIOAlignment  = 4096
+	directIOBufferSize = 64 * 1024
+)
+
+// alignedWriter collects writes into a block aligned buffer so that they
+// can be issued against a file opened with O_DIRECT. Only whole blocks
+// are written while the file is open; the remaining tail is written with
+// direct I/O switched off when the writer is flushed.
+type alignedWriter struct {
+	mu     sync.Mutex
+	file   *os.File
+	buf    []byte
+	n      int
+	offset int64
+}
+
+func newAlignedWriter(file *os.File) (*alignedWriter, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &alignedWriter{
+		file:   file,
+		buf:    alignedBuffer(directIOBufferSize),
+		offset: info.Size(),
+	}
+
+	return w, nil
+}
+
+func alignedBuffer(size int) []byte {
+	buf := make([]byte, size+directIOAlignment)
+	off := int(uintptr(unsafe.Pointer(&buf[0])) & (directIOAlignment - 1))
+	if off != 0 {
+		off = directIOAlignment - off
+	}
+
+	return buf[off : off+size]
+}
+
+func (w *alignedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	written := 0
+	for len(p) > 0 {
+		c := copy(w.buf[w.n:], p)
+		w.n += c
+		written += c
+		p = p[c:]
+
+		if w.n == len(w.buf) {
+			if err := w.flushBlocks(); err != nil {
+				return written, err
+			}
+		}
+	}
+
+	return written, nil
+}
+
+func (w *alignedWriter) flushBlocks() error {
+	if rem := int(w.offset % directIOAlignment); rem != 0 {
+		// The file does not end on a block boundary, e.g. it was
+		// appended to by a previous run, so top it up first.
+		pad := directIOAlignment - rem
+		if pad > w.n {
+			pad = w.n
+		}
+		if err := w.writeBuffered(pad); err != nil {
+			return err
+		}
+	}
+
+	if k := w.n &^ (directIOAlignment - 1); k > 0 {
+		return w.write(k)
+	}
+
+	return nil
+}
+
+func (w *alignedWriter) write(k int) error {
+	n, err := w.file.Write(w.buf[:k])
+	w.offset += int64(n)
+	w.n = copy(w.buf, w.buf[n:w.n])
+
+	return err
+}
+
+func (w *alignedWriter) writeBuffered(k int) error {
+	if err := setDirectIO(w.file, false); err != nil {
+		return err
+	}
+
+	if err := w.write(k); err != nil {
+		return err
+	}
+
+	return setDirectIO(w.file, true)
+}
+
+func (w *alignedWriter) flush() error {
+	if err := w.flushBlocks(); err != nil {
+		return err
+	}
+
+	if w.n > 0 {
+		return w.writeBuffered(w.n)
+	}
+
+	return nil
+}
+
+func (w *alignedWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.flush()
+}
+
+func (w *alignedWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	err := w.flush()
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
@@ -0,0 +1,42 @@
+//go:build linux
+// +build linux
+
+package rolling
+
+import (
+	"os"
+	"syscall"
+)
+
+const directIOFlag = syscall.O_DIRECT
+
+func setDirectIO(file *os.File, enabled bool) error {
+	conn, err := file.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var errno syscall.Errno
+	err = conn.Control(func(fd uintptr) {
+		var flags uintptr
+		flags, _, errno = syscall.Syscall(syscall.SYS_FCNTL, fd, syscall.F_GETFL, 0)
+		if errno != 0 {
+			return
+		}
+
+		if enabled {
+			flags |= syscall.O_DIRECT
+		} else {
+			flags &^= syscall.O_DIRECT
+		}
+		_, _, errno = syscall.Syscall(syscall.SYS_FCNTL, fd, syscall.F_SETFL, flags)
+	})
+	if err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
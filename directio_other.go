@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package rolling
+
+import "os"
+
+const directIOFlag = 0
+
+func setDirectIO(file *os.File, enabled bool) error {
+	return ErrDirectIOUnsupported
+}
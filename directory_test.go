@@ -0,0 +1,65 @@
+package rolling_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/importcjj/rolling"
+	"github.com/importcjj/rolling/rollingtest"
+)
+
+func TestCreateDirectoryOnRotation(t *testing.T) {
+	f := rollingtest.New(t, rolling.Config{Rotation: rolling.Hourly, CreateDirectory: true})
+	f.Write("before\n")
+
+	if err := os.RemoveAll(f.Dir); err != nil {
+		t.Fatal(err)
+	}
+
+	f.Clock.Advance(time.Hour)
+	f.Write("after\n")
+
+	f.AssertFileCount(1)
+	if got := f.Read(f.Files()[0]); got != "after\n" {
+		t.Errorf("got %q in the recreated directory", got)
+	}
+}
+
+func TestCreateDirectoryOnWriteFailure(t *testing.T) {
+	// The first file is opened read-only, so that writing to it fails as
+	// writes to a file on a remounted volume do.
+	opens := 0
+	open := func(name string, flag int, perm os.FileMode) (*os.File, error) {
+		opens++
+		if opens == 1 {
+			flag = flag&^(os.O_WRONLY|os.O_RDWR) | os.O_RDONLY
+		}
+		return os.OpenFile(name, flag, perm)
+	}
+
+	f := rollingtest.New(t, rolling.Config{
+		Rotation:        rolling.Never,
+		FilenamePrefix:  "app.log",
+		CreateDirectory: true,
+		OpenFileFunc:    open,
+	})
+
+	if err := os.RemoveAll(f.Dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Appender.Write([]byte("after\n")); err != nil {
+		t.Fatalf("write after the removal: %v", err)
+	}
+	f.Write("again\n")
+
+	data, err := os.ReadFile(filepath.Join(f.Dir, "app.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != "after\nagain\n" {
+		t.Errorf("got %q in the recreated directory", got)
+	}
+}
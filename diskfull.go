@@ -0,0 +1,102 @@
+package rolling
+
+import "time"
+
+// DiskFullPolicy decides what a write does when it fails with ENOSPC.
+type DiskFullPolicy int8
+
+const (
+	// DiskFullError returns the error to the caller.
+	DiskFullError DiskFullPolicy = iota
+	// DiskFullBlock retries the write, with backoff, until there is room
+	// again or the appender is closed.
+	DiskFullBlock
+	// DiskFullDrop discards the rest of the record and reports it as
+	// written, counting it in Stats.DiskFullDrops.
+	DiskFullDrop
+	// DiskFullEmergencyPrune removes the oldest files of the appender,
+	// regardless of the retention, until the write succeeds. Protected
+	// files and those held by a Retainer are kept. With AuditMode or
+	// NoDelete, which remove nothing, the write fails as with
+	// DiskFullError.
+	DiskFullEmergencyPrune
+	// DiskFullFallback writes the rest of the record to FallbackWriter.
+	DiskFullFallback
+)
+
+const (
+	diskFullMinBackoff = 10 * time.Millisecond
+	diskFullMaxBackoff = time.Second
+)
+
+// diskFull finishes writing p, of which n bytes were written before err,
+// according to OnDiskFull.
+func (r *RollingFileAppender) diskFull(h *fileHandle, p []byte, n int, err error) (int, error) {
+	switch r.state.onDiskFull {
+	case DiskFullBlock:
+		backoff := diskFullMinBackoff
+		for isDiskFull(err) && r.file.Load() != nil {
+			time.Sleep(backoff)
+			if backoff *= 2; backoff > diskFullMaxBackoff {
+				backoff = diskFullMaxBackoff
+			}
+
+			var m int
+			m, err = r.writeOnce(h, p[n:])
+			n += m
+		}
+		return n, err
+
+	case DiskFullDrop:
+		r.state.diskFullDrops.Add(1)
+		return len(p), nil
+
+	case DiskFullEmergencyPrune:
+		for isDiskFull(err) && r.state.pruneOldest(h.name) {
+			var m int
+			m, err = r.writeOnce(h, p[n:])
+			n += m
+		}
+		return n, err
+
+	case DiskFullFallback:
+		if _, err := r.state.fallback.Write(p[n:]); err != nil {
+			return n, err
+		}
+		return len(p), nil
+	}
+
+	return n, err
+}
+
+// pruneOldest removes the oldest file but active, and reports whether a
+// file was removed. AuditMode never removes one, and listing one for
+// deletion with NoDelete frees no space.
+func (s *state) pruneOldest(active string) bool {
+	if s.audit || s.noDelete {
+		return false
+	}
+
+	s.pruneMu.Lock()
+	defer s.pruneMu.Unlock()
+
+	files, err := s.listLogs()
+	if err != nil {
+		return false
+	}
+
+	for _, file := range s.excludeProtected(files) {
+		if _, pending := s.pendingRemovals[file.Name]; pending || file.Name == active {
+			// Files that failed to be removed are retried by the
+			// retention.
+			continue
+		}
+
+		if s.removeLog(file) {
+			s.logEvent("pruned the log file to free disk space", "file", file.Name)
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,7 @@
+package rolling
+
+// isDiskFull reports whether err is a write failing for lack of space,
+// which plan9 does not tell apart from other failures.
+func isDiskFull(err error) bool {
+	return false
+}
@@ -0,0 +1,77 @@
+//go:build linux
+
+package rolling_test
+
+import (
+	"errors"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/importcjj/rolling"
+	"github.com/importcjj/rolling/rollingtest"
+)
+
+// fullAfterRotation returns an OpenFileFunc opening /dev/full, which fails
+// every write with ENOSPC, once full is set.
+func fullAfterRotation(full *atomic.Bool) func(string, int, os.FileMode) (*os.File, error) {
+	return func(name string, flag int, perm os.FileMode) (*os.File, error) {
+		if full.Load() {
+			return os.OpenFile("/dev/full", os.O_WRONLY, 0)
+		}
+		return os.OpenFile(name, flag, perm)
+	}
+}
+
+func TestEmergencyPruneInAuditMode(t *testing.T) {
+	var full atomic.Bool
+	f := rollingtest.New(t, rolling.Config{
+		Rotation:     rolling.Hourly,
+		AuditMode:    true,
+		OnDiskFull:   rolling.DiskFullEmergencyPrune,
+		OpenFileFunc: fullAfterRotation(&full),
+	})
+	f.Write("kept\n")
+	old := f.Files()
+
+	full.Store(true)
+	f.Clock.Advance(time.Hour)
+	if _, err := f.Appender.Write([]byte("lost\n")); !errors.Is(err, syscall.ENOSPC) {
+		t.Errorf("got %v writing to a full disk, want ENOSPC", err)
+	}
+
+	if got := f.Read(old[0]); got != "kept\n" {
+		t.Errorf("got %q in %s", got, old[0])
+	}
+}
+
+func TestEmergencyPruneWithNoDelete(t *testing.T) {
+	var full atomic.Bool
+	f := rollingtest.New(t, rolling.Config{
+		Rotation:     rolling.Hourly,
+		NoDelete:     true,
+		OnDiskFull:   rolling.DiskFullEmergencyPrune,
+		OpenFileFunc: fullAfterRotation(&full),
+	})
+	f.Write("kept\n")
+
+	full.Store(true)
+	f.Clock.Advance(time.Hour)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := f.Appender.Write([]byte("lost\n"))
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, syscall.ENOSPC) {
+			t.Errorf("got %v writing to a full disk, want ENOSPC", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the write did not return")
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package rolling
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isDiskFull reports whether err is a write failing for lack of space.
+func isDiskFull(err error) bool {
+	return errors.Is(err, syscall.ENOSPC)
+}
@@ -0,0 +1,17 @@
+package rolling
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Windows reports a full disk with its own error codes.
+const (
+	errorHandleDiskFull syscall.Errno = 39
+	errorDiskFull       syscall.Errno = 112
+)
+
+// isDiskFull reports whether err is a write failing for lack of space.
+func isDiskFull(err error) bool {
+	return errors.Is(err, syscall.ENOSPC) || errors.Is(err, errorDiskFull) || errors.Is(err, errorHandleDiskFull)
+}
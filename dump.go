@@ -0,0 +1,88 @@
+package rolling
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DumpState writes a line describing the appender to w: the active file
+// and its size, the rotation and when it is next due, the depth of the
+// upload and compression queues and the counters of Stats, for finding out
+// why a file does not rotate.
+func (r *RollingFileAppender) DumpState(w io.Writer) error {
+	h := r.file.Load()
+	if h == nil {
+		return os.ErrClosed
+	}
+	stats := r.Stats()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "rolling: state file=%q size=%d generation=%d parked=%t",
+		path.Join(r.state.logDirectory, h.name), stats.FileSize, h.generation, h.parked)
+
+	fmt.Fprintf(&b, " rotation=%v", r.state.rotation)
+	switch next := atomic.LoadInt64(&r.state.nextDate); {
+	case !r.state.rotates || next == 0:
+		b.WriteString(" next_rotation=never")
+	case next == pendingAnchor:
+		b.WriteString(" next_rotation=first_write")
+	default:
+		fmt.Fprintf(&b, " next_rotation=%s", time.Unix(0, next).In(r.state.location.Load()).Format(time.RFC3339Nano))
+	}
+
+	if u := r.state.uploader; u != nil {
+		u.mu.Lock()
+		fmt.Fprintf(&b, " upload_queue=%d", len(u.queue))
+		u.mu.Unlock()
+	}
+	if c := r.state.compressor; c != nil {
+		c.mu.Lock()
+		fmt.Fprintf(&b, " compress_queue=%d", c.pending)
+		c.mu.Unlock()
+	}
+
+	fmt.Fprintf(&b, " prune_failures=%d pending_removals=%d disk_full_drops=%d\n",
+		stats.PruneFailures, stats.PendingRemovals, stats.DiskFullDrops)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// dumpOnSignal calls DumpState on every dumpSignals until the returned
+// function is called.
+func (r *RollingFileAppender) dumpOnSignal(w io.Writer) (stop func()) {
+	if len(dumpSignals) == 0 {
+		return func() {}
+	}
+	if w == nil {
+		w = r
+	}
+
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, dumpSignals...)
+
+	go func() {
+		for {
+			select {
+			case <-signals:
+				if err := r.DumpState(w); err != nil {
+					r.state.logError("failed to dump the state", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package rolling
+
+import "os"
+
+// There is no SIGUSR1 to dump the state on.
+var dumpSignals []os.Signal
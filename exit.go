@@ -0,0 +1,81 @@
+package rolling
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// Syncer is implemented by RollingFileAppender and AsyncWriter.
+type Syncer interface {
+	Sync() error
+}
+
+var exitHooks struct {
+	sync.Mutex
+	syncers map[*Syncer]Syncer
+	signals chan os.Signal
+}
+
+// FlushOnExit syncs w when the process receives SIGINT or SIGTERM, or
+// exits through Exit, so that the last lines logged before dying are not
+// lost. After syncing on a signal the signal is raised again with the
+// default behavior restored. The returned function unregisters w.
+func FlushOnExit(w Syncer) (stop func()) {
+	exitHooks.Lock()
+	defer exitHooks.Unlock()
+
+	if exitHooks.syncers == nil {
+		exitHooks.syncers = make(map[*Syncer]Syncer)
+	}
+
+	key := &w
+	exitHooks.syncers[key] = w
+
+	if exitHooks.signals == nil {
+		exitHooks.signals = make(chan os.Signal, 1)
+		signal.Notify(exitHooks.signals, os.Interrupt, syscall.SIGTERM)
+		go waitExitSignal(exitHooks.signals)
+	}
+
+	return func() {
+		exitHooks.Lock()
+		defer exitHooks.Unlock()
+
+		delete(exitHooks.syncers, key)
+	}
+}
+
+func waitExitSignal(signals chan os.Signal) {
+	sig := <-signals
+
+	syncOnExit()
+	signal.Stop(signals)
+
+	p, err := os.FindProcess(os.Getpid())
+	if err == nil {
+		err = p.Signal(sig)
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// Exit syncs everything registered with FlushOnExit and exits with code.
+func Exit(code int) {
+	syncOnExit()
+	os.Exit(code)
+}
+
+func syncOnExit() {
+	exitHooks.Lock()
+	defer exitHooks.Unlock()
+
+	for _, s := range exitHooks.syncers {
+		if err := s.Sync(); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package rolling
+
+import "strings"
+
+// FanoutPolicy decides when a partially failed call of a Fanout fails.
+type FanoutPolicy int8
+
+const (
+	// FailOnAny fails a call when any destination fails.
+	FailOnAny FanoutPolicy = iota
+	// FailOnAll fails a call only when every destination fails, e.g. to
+	// keep logging locally while a network archive is unavailable.
+	FailOnAll
+)
+
+// Fanout is an Appender writing to several destinations, each of which
+// is written to, synced, rotated and closed in order regardless of the
+// others' failures. Set Policy and OnError before using it.
+type Fanout struct {
+	Policy FanoutPolicy
+	// OnError is called with every failure of a destination.
+	OnError func(destination Appender, err error)
+
+	appenders []Appender
+}
+
+var _ Appender = (*Fanout)(nil)
+
+func NewFanout(appenders ...Appender) *Fanout {
+	return &Fanout{appenders: appenders}
+}
+
+// FanoutError holds the errors of the destinations that failed.
+type FanoutError []error
+
+func (e FanoutError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+
+	return "rolling: " + strings.Join(msgs, "; ")
+}
+
+func (e FanoutError) Unwrap() []error {
+	return e
+}
+
+func (f *Fanout) each(fn func(Appender) error) error {
+	var errs FanoutError
+	for _, a := range f.appenders {
+		if err := fn(a); err != nil {
+			errs = append(errs, err)
+			if f.OnError != nil {
+				f.OnError(a, err)
+			}
+		}
+	}
+
+	if len(errs) == 0 || f.Policy == FailOnAll && len(errs) < len(f.appenders) {
+		return nil
+	}
+
+	return errs
+}
+
+// Write writes p to every destination in turn, so a slow destination
+// delays the ones after it and a call takes as long as all of them: put
+// the local files first, and a network archive behind a queue of its own.
+// A failed call reports 0 bytes written even though p may have reached
+// the destinations OnError was not called with.
+func (f *Fanout) Write(p []byte) (int, error) {
+	err := f.each(func(a Appender) error {
+		_, err := a.Write(p)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (f *Fanout) Sync() error {
+	return f.each(Appender.Sync)
+}
+
+func (f *Fanout) Rotate() error {
+	return f.each(Appender.Rotate)
+}
+
+func (f *Fanout) Close() error {
+	return f.each(Appender.Close)
+}
+
+// CurrentFilename returns the current file of the first destination.
+func (f *Fanout) CurrentFilename() string {
+	if len(f.appenders) == 0 {
+		return ""
+	}
+
+	return f.appenders[0].CurrentFilename()
+}
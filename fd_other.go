@@ -0,0 +1,10 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package rolling
+
+import "os"
+
+func dupFile(file *os.File) (*os.File, error) {
+	return nil, ErrFileUnsupported
+}
@@ -0,0 +1,244 @@
+package rolling
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileInfo describes one of the log files of an appender.
+type FileInfo struct {
+	// Path is the path of the file, Name its slash separated path relative
+	// to the log directory.
+	Path string
+	Name string
+	// PeriodStart and PeriodEnd bound the rotation period the file belongs
+	// to. They are zero when the name carries no date.
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+	Size        int64
+	ModTime     time.Time
+	Sequence    int
+	// Compressed reports whether the file has an archive extension such
+	// as ".gz".
+	Compressed bool
+}
+
+// fileInfo describes the file with the given relative name, stat-ing it
+// for its size.
+func (s *state) fileInfo(name string) FileInfo {
+	info := s.nameInfo(name)
+	if fi, err := os.Stat(info.Path); err == nil {
+		info.Size = fi.Size()
+		info.ModTime = fi.ModTime()
+	}
+
+	return info
+}
+
+// entryInfo is fileInfo for a listed file, without stat-ing it: the size
+// and modification time are those of the entry or, for a file being
+// written to, its current size and the current time.
+func (s *state) entryInfo(entry *logEntry) FileInfo {
+	info := s.nameInfo(entry.Name)
+	info.Size, info.ModTime = entry.Size, entry.ModTime
+
+	s.openMu.Lock()
+	h := s.open[entry.Name]
+	s.openMu.Unlock()
+	if h != nil {
+		info.Size, info.ModTime = h.size.Load(), s.getNow()
+	}
+
+	return info
+}
+
+// nameInfo is the part of FileInfo taken from the name.
+func (s *state) nameInfo(name string) FileInfo {
+	info := FileInfo{
+		Path: path.Join(s.logDirectory, name),
+		Name: name,
+	}
+
+	_, info.Compressed = trimArchiveExt(name)
+	if date, seq, ok := s.parseFilename(name); ok {
+		info.Sequence = seq
+		if !date.IsZero() {
+			info.PeriodStart, info.PeriodEnd = s.period(date)
+		}
+	}
+
+	return info
+}
+
+// period returns the bounds of the rotation period containing date.
+func (s *state) period(date time.Time) (time.Time, time.Time) {
+	if _, ok := s.rotation.(PeriodicRotation); ok && s.rotation != Never {
+		return PeriodOf(s.rotation, date)
+	}
+
+	return date, NextBoundary(s.rotation, date)
+}
+
+// parseFilename extracts the date and sequence number from the name of one
+// of the appender's files, archive extensions included. Directories are
+// only looked at with PartitionLayout.
+func (s *state) parseFilename(name string) (time.Time, int, bool) {
+	var partition time.Time
+	if len(s.partition) > 0 {
+		date, ok := s.parsePartition(name)
+		if !ok {
+			return time.Time{}, 0, false
+		}
+		partition = date
+	}
+
+	stem, _ := trimArchiveExt(path.Base(name))
+	if !strings.HasPrefix(stem, s.namePrefix) || !strings.HasSuffix(stem, s.logFilenameSuffix) {
+		return time.Time{}, 0, false
+	}
+
+	if len(s.namePrefix)+len(s.logFilenameSuffix) > len(stem) {
+		return time.Time{}, 0, false
+	}
+	middle := stem[len(s.namePrefix) : len(stem)-len(s.logFilenameSuffix)]
+
+	if (s.rotation == Never || len(s.partition) > 0) && (len(s.namePrefix) > 0 || len(s.logFilenameSuffix) > 0) {
+		if len(middle) == 0 {
+			return partition, 0, true
+		}
+
+		seq, err := strconv.Atoi(strings.TrimPrefix(middle, "."))
+		return partition, seq, err == nil && seq > 0
+	}
+
+	// The sequence is tried first, since time.Parse takes a ".1" after
+	// the seconds for a fraction the layout does not have.
+	if i := strings.LastIndex(middle, "."); i >= 0 {
+		seq, err := strconv.Atoi(middle[i+1:])
+		if err == nil && seq > 0 {
+			if date, err := s.parseName(s.dateFormat, middle[:i]); err == nil {
+				return date, seq, true
+			}
+		}
+	}
+
+	date, err := s.parseName(s.dateFormat, middle)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+
+	return date, 0, true
+}
+
+// parsePartition extracts the date from the PartitionLayout directories
+// name is in.
+func (s *state) parsePartition(name string) (time.Time, bool) {
+	parts := strings.Split(name, "/")
+	depth := strings.Count(s.partition, "/") + 1
+	if len(parts) <= depth {
+		return time.Time{}, false
+	}
+
+	dirs := strings.Join(parts[len(parts)-1-depth:len(parts)-1], "/")
+	date, err := s.parseName(s.partition, dirs)
+	return date, err == nil
+}
+
+// ParseFilename extracts the date and sequence number from the name of a
+// log file written with the config, as the appender itself does. Archive
+// extensions such as ".gz" are ignored. The date is zero for Never. With
+// PartitionLayout, name must include the partition directories.
+func ParseFilename(name string, config Config) (time.Time, int, bool) {
+	s, err := newNamingState(config)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+
+	return s.parseFilename(filepath.ToSlash(name))
+}
+
+// SortFiles sorts the names of log files written with the config by date
+// and sequence number, as parsed by ParseFilename, rather than lexically.
+// Names that do not parse come last, in lexical order.
+func SortFiles(names []string, config Config) error {
+	s, err := newNamingState(config)
+	if err != nil {
+		return err
+	}
+
+	type key struct {
+		date time.Time
+		seq  int
+		ok   bool
+	}
+	keys := make(map[string]key, len(names))
+	for _, name := range names {
+		date, seq, ok := s.parseFilename(filepath.ToSlash(name))
+		keys[name] = key{date, seq, ok}
+	}
+
+	sort.SliceStable(names, func(i, j int) bool {
+		a, b := keys[names[i]], keys[names[j]]
+		switch {
+		case a.ok != b.ok:
+			return a.ok
+		case !a.ok:
+			return names[i] < names[j]
+		case !a.date.Equal(b.date):
+			return a.date.Before(b.date)
+		case a.seq != b.seq:
+			return a.seq < b.seq
+		}
+		return names[i] < names[j]
+	})
+
+	return nil
+}
+
+// existingPeriodFile returns the date and sequence number of the newest
+// file of the period containing now, if there is one, to append to. When
+// that file is archived or queued for compression it returns the next
+// sequence number instead, since compressing the file again would replace
+// the archive.
+func (s *state) existingPeriodFile(now time.Time) (time.Time, int, bool) {
+	r, ok := s.rotation.(PeriodicRotation)
+	if !ok || s.rotation == Never {
+		return time.Time{}, 0, false
+	}
+
+	period := r.Round(now)
+
+	var found, done bool
+	var date time.Time
+	var seq int
+	s.walkLogs(func(name string) {
+		if strings.Contains(name, "/") && len(s.partition) == 0 {
+			return
+		}
+
+		d, n, ok := s.parseFilename(name)
+		if !ok || !r.Round(d).Equal(period) {
+			return
+		}
+		_, archived := trimArchiveExt(name)
+		archived = archived || s.compressor != nil && s.compressor.queued(s, name)
+
+		switch {
+		case !found || d.After(date) || (d.Equal(date) && n > seq):
+			found, date, seq, done = true, d, n, archived
+		case d.Equal(date) && n == seq:
+			done = done || archived
+		}
+	})
+
+	if done {
+		seq++
+	}
+
+	return date, seq, found
+}
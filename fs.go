@@ -0,0 +1,102 @@
+package rolling
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+)
+
+// FS returns the log directory as an fs.FS holding only the appender's
+// files, archives included, e.g. for fs.WalkDir or http.FileServerFS.
+// Subdirectories are only visible with RecursivePrune.
+func (r *RollingFileAppender) FS() fs.FS {
+	return &logFS{s: r.state, fsys: os.DirFS(r.state.logDirectory)}
+}
+
+type logFS struct {
+	s    *state
+	fsys fs.FS
+}
+
+func (l *logFS) visible(name string, dir bool) bool {
+	if dir {
+		return name == "." || l.s.recursivePrune
+	}
+
+	return l.s.matches(path.Base(name))
+}
+
+func (l *logFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	f, err := l.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if !info.Mode().IsRegular() && !info.IsDir() || !l.visible(name, info.IsDir()) {
+		f.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	if !info.IsDir() {
+		return f, nil
+	}
+
+	dir, ok := f.(fs.ReadDirFile)
+	if !ok {
+		f.Close()
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not implemented")}
+	}
+
+	all, err := dir.ReadDir(-1)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	entries := all[:0]
+	for _, entry := range all {
+		if (entry.Type().IsRegular() || entry.IsDir()) && l.visible(path.Join(name, entry.Name()), entry.IsDir()) {
+			entries = append(entries, entry)
+		}
+	}
+
+	return &logDir{ReadDirFile: dir, entries: entries}, nil
+}
+
+// logDir is a directory of a logFS, listing only the visible entries.
+type logDir struct {
+	fs.ReadDirFile
+	entries []fs.DirEntry
+}
+
+func (d *logDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+
+	return entries, nil
+}
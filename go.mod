@@ -1,5 +1,5 @@
 module github.com/importcjj/rolling
 
-go 1.16
+go 1.21
 
 require github.com/djherbis/times v1.5.0
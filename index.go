@@ -0,0 +1,235 @@
+package rolling
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultIndexRescan is how often IndexFiles reads the directory when
+// IndexRescan is zero.
+const DefaultIndexRescan = time.Hour
+
+// fileIndex keeps the log files between scans of the directory, oldest
+// first, with IndexFiles. The appender adds the files it creates and drops
+// those it removes or compresses; scans pick up changes made by others.
+type fileIndex struct {
+	mu      sync.Mutex
+	entries []*logEntry
+	scanned time.Time
+	rescan  time.Duration
+	// persist is the path the index is saved to with PersistIndex.
+	persist string
+}
+
+func (s *state) indexFilename() string {
+	return s.logFilenamePrefix + "index" + s.logFilenameSuffix
+}
+
+func newFileIndex(s *state, rescan time.Duration, persist bool) (*fileIndex, error) {
+	x := &fileIndex{rescan: rescan}
+	if x.rescan <= 0 {
+		x.rescan = DefaultIndexRescan
+	}
+	if !persist {
+		return x, nil
+	}
+
+	x.persist = path.Join(s.logDirectory, s.indexFilename())
+	data, err := os.ReadFile(x.persist)
+	if os.IsNotExist(err) {
+		return x, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// A damaged index is dropped, and rebuilt by the next scan.
+	if err := x.decode(s, data); err != nil {
+		s.logError("failed to read the file index", err, "file", s.indexFilename())
+		x.entries, x.scanned = nil, time.Time{}
+	}
+
+	return x, nil
+}
+
+// fresh returns a copy of the entries if the last scan is recent enough.
+func (x *fileIndex) fresh(now time.Time) ([]*logEntry, bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.scanned.IsZero() || now.Sub(x.scanned) >= x.rescan || now.Before(x.scanned) {
+		return nil, false
+	}
+
+	return append([]*logEntry(nil), x.entries...), true
+}
+
+// replace stores the result of a scan.
+func (x *fileIndex) replace(s *state, files []*logEntry, now time.Time) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.entries = append(x.entries[:0:0], files...)
+	x.scanned = now
+	x.save(s)
+}
+
+// add records a file the appender has created, unless scanned already.
+func (x *fileIndex) add(s *state, entry *logEntry) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	for _, e := range x.entries {
+		if e.Name == entry.Name {
+			return
+		}
+	}
+
+	i := sort.Search(len(x.entries), func(i int) bool {
+		return entryBefore(entry, x.entries[i])
+	})
+	x.entries = append(x.entries, nil)
+	copy(x.entries[i+1:], x.entries[i:])
+	x.entries[i] = entry
+	x.save(s)
+}
+
+// remove drops the file name, and records it as renamed to renamed when
+// that is not empty.
+func (x *fileIndex) remove(s *state, name, renamed string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	for i, e := range x.entries {
+		if e.Name != name {
+			continue
+		}
+
+		if len(renamed) > 0 {
+			r := *e
+			r.Name, r.FullPath = renamed, path.Join(s.logDirectory, renamed)
+			x.entries[i] = &r
+		} else {
+			x.entries = append(x.entries[:i], x.entries[i+1:]...)
+		}
+		x.save(s)
+		return
+	}
+}
+
+// update records the size and modification time of name.
+func (x *fileIndex) update(s *state, name string, size int64, mtime time.Time) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	for i, e := range x.entries {
+		if e.Name != name {
+			continue
+		}
+
+		// Entries are handed out by fresh, so they are replaced rather
+		// than written to.
+		u := *e
+		u.Size, u.ModTime = size, mtime
+		x.entries[i] = &u
+		x.save(s)
+		return
+	}
+}
+
+// save writes the index with PersistIndex: the time of the last scan on
+// the first line, then a line of birth time, sequence number, size,
+// modification time and name per file.
+func (x *fileIndex) save(s *state) {
+	if len(x.persist) == 0 {
+		return
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%d\n", x.scanned.UnixNano())
+	for _, e := range x.entries {
+		fmt.Fprintf(&b, "%d %d %d %d %s\n", e.Ctime.UnixNano(), e.Seq, e.Size, e.ModTime.UnixNano(), e.Name)
+	}
+
+	if err := writeFileAtomic(x.persist, b.Bytes(), s.fileMode); err != nil {
+		s.logError("failed to save the file index", err, "file", s.indexFilename())
+	}
+}
+
+func (x *fileIndex) decode(s *state, data []byte) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	if !scanner.Scan() {
+		return fmt.Errorf("rolling: empty file index")
+	}
+	scanned, err := strconv.ParseInt(scanner.Text(), 10, 64)
+	if err != nil {
+		return err
+	}
+	x.scanned = time.Unix(0, scanned)
+
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), " ", 5)
+		if len(fields) != 5 {
+			return fmt.Errorf("rolling: bad file index line %q", scanner.Text())
+		}
+
+		ctime, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return err
+		}
+		seq, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return err
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return err
+		}
+		mtime, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return err
+		}
+
+		x.entries = append(x.entries, &logEntry{
+			Name:     fields[4],
+			FullPath: path.Join(s.logDirectory, fields[4]),
+			Ctime:    time.Unix(0, ctime),
+			Seq:      seq,
+			Size:     size,
+			ModTime:  time.Unix(0, mtime),
+		})
+	}
+
+	return scanner.Err()
+}
+
+// indexCreated adds the file name, just created, to the index.
+func (s *state) indexCreated(name string) {
+	if s.index == nil {
+		return
+	}
+
+	// As in a scan, files without a birth time are left out.
+	entry := &logEntry{Name: name, FullPath: path.Join(s.logDirectory, name)}
+	if err := s.statEntry(entry); err != nil || entry.Ctime.IsZero() {
+		return
+	}
+
+	s.index.add(s, entry)
+}
+
+// indexRemoved drops the file name from the index, as renamed to renamed
+// when that is not empty.
+func (s *state) indexRemoved(name, renamed string) {
+	if s.index != nil {
+		s.index.remove(s, name, renamed)
+	}
+}
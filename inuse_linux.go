@@ -0,0 +1,62 @@
+//go:build linux
+// +build linux
+
+package rolling
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// openElsewhere returns the paths among paths that another process has
+// open, found by scanning the descriptors in /proc like fuser. Processes
+// whose descriptors cannot be read, such as those of other users, are
+// missed.
+func openElsewhere(paths []string) map[string]bool {
+	wanted := make(map[string]string, len(paths))
+	for _, p := range paths {
+		resolved, err := filepath.EvalSymlinks(p)
+		if err != nil {
+			continue
+		}
+		if abs, err := filepath.Abs(resolved); err == nil {
+			wanted[abs] = p
+		}
+	}
+
+	open := make(map[string]bool)
+	if len(wanted) == 0 {
+		return open
+	}
+
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return open
+	}
+
+	self := strconv.Itoa(os.Getpid())
+	for _, proc := range procs {
+		if _, err := strconv.Atoi(proc.Name()); err != nil || proc.Name() == self {
+			continue
+		}
+
+		dir := filepath.Join("/proc", proc.Name(), "fd")
+		fds, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		for _, fd := range fds {
+			target, err := os.Readlink(filepath.Join(dir, fd.Name()))
+			if err != nil {
+				continue
+			}
+			if p, ok := wanted[target]; ok {
+				open[p] = true
+			}
+		}
+	}
+
+	return open
+}
@@ -0,0 +1,54 @@
+package rolling
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+)
+
+const journaldSocket = "/run/systemd/journal/socket"
+
+type journaldWriter struct {
+	conn       *net.UnixConn
+	identifier string
+}
+
+// NewJournaldMirror connects to the systemd journal and returns a writer
+// suitable for Config.Mirror. Every write is sent as one journal entry
+// tagged with SYSLOG_IDENTIFIER=identifier.
+func NewJournaldMirror(identifier string) (io.WriteCloser, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journaldSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+
+	return &journaldWriter{conn: conn, identifier: identifier}, nil
+}
+
+func (w *journaldWriter) Write(p []byte) (int, error) {
+	message := bytes.TrimSuffix(p, []byte("\n"))
+
+	var buf bytes.Buffer
+	buf.WriteString("PRIORITY=6\n")
+	if len(w.identifier) > 0 {
+		buf.WriteString("SYSLOG_IDENTIFIER=" + w.identifier + "\n")
+	}
+
+	// The binary-safe form of the native protocol, since records may
+	// contain newlines.
+	buf.WriteString("MESSAGE\n")
+	binary.Write(&buf, binary.LittleEndian, uint64(len(message)))
+	buf.Write(message)
+	buf.WriteByte('\n')
+
+	if _, err := w.conn.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (w *journaldWriter) Close() error {
+	return w.conn.Close()
+}
@@ -0,0 +1,111 @@
+package rolling
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync/atomic"
+)
+
+// JSONLinesWriter turns every write into JSON lines for collectors that
+// take one record per line. A write holding a JSON value, or one per line,
+// is compacted onto a single line each; anything else is wrapped as the
+// "message" string of an object, with its newlines escaped.
+type JSONLinesWriter struct {
+	w io.Writer
+
+	records   atomic.Uint64
+	compacted atomic.Uint64
+	wrapped   atomic.Uint64
+}
+
+// JSONLinesStats counts the records of a JSONLinesWriter. Compacted and
+// Wrapped count the records that had to be fixed up.
+type JSONLinesStats struct {
+	Records   uint64
+	Compacted uint64
+	Wrapped   uint64
+}
+
+// NewJSONLines returns a JSONLinesWriter writing its lines to w, usually a
+// RollingFileAppender.
+func NewJSONLines(w io.Writer) *JSONLinesWriter {
+	return &JSONLinesWriter{w: w}
+}
+
+// Write writes p to the underlying writer in a single call, and reports
+// len(p) written when that succeeds. The records of a failed write are not
+// counted.
+func (j *JSONLinesWriter) Write(p []byte) (int, error) {
+	buf := batchPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer putBatch(buf)
+
+	var stats JSONLinesStats
+	record := bytes.TrimSpace(p)
+	switch {
+	case len(record) == 0:
+		return len(p), nil
+
+	case json.Valid(record):
+		compactRecord(buf, record, &stats)
+
+	case validLines(record):
+		for _, line := range bytes.Split(record, newline) {
+			if line = bytes.TrimSpace(line); len(line) > 0 {
+				compactRecord(buf, line, &stats)
+			}
+		}
+
+	default:
+		stats.Records++
+		stats.Wrapped++
+		message, _ := json.Marshal(string(record))
+		buf.WriteString(`{"message":`)
+		buf.Write(message)
+		buf.WriteString("}\n")
+	}
+
+	if _, err := j.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+
+	j.records.Add(stats.Records)
+	j.compacted.Add(stats.Compacted)
+	j.wrapped.Add(stats.Wrapped)
+
+	return len(p), nil
+}
+
+// compactRecord appends the JSON value record to buf on a line of its own.
+func compactRecord(buf *bytes.Buffer, record []byte, stats *JSONLinesStats) {
+	stats.Records++
+
+	start := buf.Len()
+	json.Compact(buf, record)
+	if !bytes.Equal(buf.Bytes()[start:], record) {
+		stats.Compacted++
+	}
+	buf.WriteByte('\n')
+}
+
+// validLines reports whether every non-blank line of record is a JSON
+// value.
+func validLines(record []byte) bool {
+	for _, line := range bytes.Split(record, newline) {
+		if line = bytes.TrimSpace(line); len(line) > 0 && !json.Valid(line) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Stats returns the records written so far.
+func (j *JSONLinesWriter) Stats() JSONLinesStats {
+	return JSONLinesStats{
+		Records:   j.records.Load(),
+		Compacted: j.compacted.Load(),
+		Wrapped:   j.wrapped.Load(),
+	}
+}
@@ -0,0 +1,82 @@
+package rolling
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// Latency summarizes the durations of an operation. Percentiles are upper
+// bounds, exact to a factor of two.
+type Latency struct {
+	Count uint64
+	P50   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+// histogram counts durations in buckets of powers of two nanoseconds.
+type histogram struct {
+	buckets [64]atomic.Uint64
+	max     atomic.Int64
+}
+
+func (h *histogram) observe(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	h.buckets[bits.Len64(uint64(d))].Add(1)
+
+	for {
+		max := h.max.Load()
+		if int64(d) <= max || h.max.CompareAndSwap(max, int64(d)) {
+			return
+		}
+	}
+}
+
+func (h *histogram) since(start time.Time) {
+	h.observe(time.Since(start))
+}
+
+func (h *histogram) latency() Latency {
+	var counts [64]uint64
+	var l Latency
+	for i := range h.buckets {
+		counts[i] = h.buckets[i].Load()
+		l.Count += counts[i]
+	}
+	l.Max = time.Duration(h.max.Load())
+	l.P50 = h.quantile(counts[:], l.Count, 0.50, l.Max)
+	l.P99 = h.quantile(counts[:], l.Count, 0.99, l.Max)
+
+	return l
+}
+
+func (h *histogram) quantile(counts []uint64, total uint64, q float64, max time.Duration) time.Duration {
+	if total == 0 {
+		return 0
+	}
+
+	rank := uint64(q * float64(total))
+	if rank == 0 {
+		rank = 1
+	}
+
+	var seen uint64
+	for i, n := range counts {
+		seen += n
+		if seen >= rank {
+			upper := time.Duration(1)<<i - 1
+			if i == 0 {
+				upper = 0
+			}
+			if upper > max {
+				upper = max
+			}
+			return upper
+		}
+	}
+
+	return max
+}
@@ -0,0 +1,38 @@
+package rolling
+
+import (
+	"fmt"
+	"os"
+)
+
+// logError reports an error the appender cannot return to its caller, to
+// the InternalLogger or, without one, to stderr, as it was before
+// RedirectStdio.
+func (s *state) logError(msg string, err error, args ...any) {
+	if s.logger == nil {
+		stderr := s.stderr.Load()
+		if stderr == nil {
+			stderr = os.Stderr
+		}
+		fmt.Fprintln(stderr, append([]any{msg, err}, args...)...)
+		return
+	}
+
+	s.logger.Error(msg, append([]any{"err", err}, args...)...)
+}
+
+// logEvent reports a rotation, prune or other internal event to the
+// InternalLogger, if there is one.
+func (s *state) logEvent(msg string, args ...any) {
+	if s.logger != nil {
+		s.logger.Info(msg, args...)
+	}
+}
+
+// logWarning reports a likely misconfiguration to the InternalLogger, if
+// there is one.
+func (s *state) logWarning(msg string, args ...any) {
+	if s.logger != nil {
+		s.logger.Warn(msg, args...)
+	}
+}
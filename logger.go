@@ -0,0 +1,14 @@
+package rolling
+
+import "log"
+
+// NewStdLogger returns a *log.Logger writing to a new appender. The
+// appender is returned as well so that it can be closed.
+func NewStdLogger(config Config, prefix string, flags int) (*log.Logger, *RollingFileAppender, error) {
+	appender, err := New(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return log.New(appender, prefix, flags), appender, nil
+}
@@ -0,0 +1,273 @@
+package rolling
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DirectoryManager shares the disk budget of a directory among the
+// appenders writing to it under different prefixes. Each appender may
+// have a quota of its own; when the files of all of them exceed the
+// budget, the oldest files of the appenders furthest over their share are
+// removed first. Shares are proportional to the quotas, and equal for
+// appenders without one. The manager prunes after every rotation of its
+// appenders, in addition to their Retention, and leaves the files of
+// appenders in AuditMode alone. Unlike other appenders sharing a
+// directory, its appenders may have prefixes extending one another, as
+// "app" and "app-http": the files of the longer prefix are left out of
+// the shorter one's.
+type DirectoryManager struct {
+	// MaxOpenFiles, when positive, caps the files its appenders keep open,
+	// for processes with a low descriptor limit. The file of the appender
+	// that has gone longest without a write is closed first, and reopened
+	// on its next write. Set it before creating appenders.
+	MaxOpenFiles int
+	// CompressWorkers and CompressInterval bound the compression of the
+	// files of appenders with Compress, shared among all of them: at most
+	// CompressWorkers files, one when zero, are compressed at a time, and
+	// their starts are at least CompressInterval apart. Set them before
+	// creating appenders.
+	CompressWorkers  int
+	CompressInterval time.Duration
+
+	directory string
+	budget    int64
+	uses      atomic.Int64
+
+	mu         sync.Mutex
+	members    []*managedAppender
+	compressor *compressor
+}
+
+type managedAppender struct {
+	appender *RollingFileAppender
+	quota    int64
+}
+
+// NewDirectoryManager returns a manager for directory. A budget of zero
+// or less means only the quotas apply.
+func NewDirectoryManager(directory string, budget int64) *DirectoryManager {
+	return &DirectoryManager{directory: directory, budget: budget}
+}
+
+// New creates an appender writing to the managed directory, whose files
+// are kept within quota bytes when quota is positive. The appender leaves
+// the manager when it is closed.
+func (m *DirectoryManager) New(config Config, quota int64) (*RollingFileAppender, error) {
+	config.Directory = m.directory
+
+	a, err := newAppender(config, m)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	m.members = append(m.members, &managedAppender{appender: a, quota: quota})
+	if a.state.compressor != nil {
+		// The appender's own compressor has not been used yet.
+		if m.compressor == nil {
+			m.compressor = newCompressor(m.CompressWorkers, m.CompressInterval)
+		}
+		a.state.compressor = m.compressor
+	}
+	m.mu.Unlock()
+
+	m.opened(a)
+
+	return a, nil
+}
+
+// opened closes the least recently written files beyond MaxOpenFiles
+// after a has opened one.
+func (m *DirectoryManager) opened(a *RollingFileAppender) {
+	if m.MaxOpenFiles <= 0 {
+		return
+	}
+	a.lastUse.Store(m.uses.Add(1))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var open []*RollingFileAppender
+	for _, member := range m.members {
+		if h := member.appender.file.Load(); h != nil && !h.parked {
+			open = append(open, member.appender)
+		}
+	}
+
+	sort.Slice(open, func(i, j int) bool {
+		return open[i].lastUse.Load() < open[j].lastUse.Load()
+	})
+
+	excess := len(open) - m.MaxOpenFiles
+	for _, appender := range open {
+		if excess <= 0 {
+			break
+		}
+		if appender != a && appender.park() {
+			excess--
+		}
+	}
+}
+
+func (m *DirectoryManager) remove(a *RollingFileAppender) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, member := range m.members {
+		if member.appender == a {
+			m.members = append(m.members[:i], m.members[i+1:]...)
+			return
+		}
+	}
+}
+
+type managedFiles struct {
+	*managedAppender
+	files []*logEntry
+	sizes []int64
+	total int64
+	share int64
+}
+
+func (f *managedFiles) removeOldest() (string, bool) {
+	s := f.appender.state
+	for len(f.files) > 0 {
+		file, size := f.files[0], f.sizes[0]
+		f.files, f.sizes = f.files[1:], f.sizes[1:]
+
+		s.pruneMu.Lock()
+		ok := s.removeLog(file)
+		s.pruneMu.Unlock()
+
+		if ok {
+			f.total -= size
+			return file.Name, true
+		}
+	}
+
+	return "", false
+}
+
+// Prune enforces the quotas and the budget now, and returns the names of
+// the removed files. Active and protected files are never removed.
+func (m *DirectoryManager) Prune() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// A file matching several prefixes belongs to the longest one.
+	active := make(map[string]bool, len(m.members))
+	for _, member := range m.members {
+		if h := member.appender.file.Load(); h != nil {
+			active[h.name] = true
+		}
+	}
+
+	owners := make(map[string]*managedFiles)
+	all := make([]*managedFiles, 0, len(m.members))
+	listed := make([][]*logEntry, 0, len(m.members))
+	for _, member := range m.members {
+		s := member.appender.state
+		if s.audit {
+			continue
+		}
+
+		files, err := s.listLogs()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read dir: %w", err)
+		}
+
+		owned := &managedFiles{managedAppender: member}
+		all = append(all, owned)
+		listed = append(listed, files)
+
+		for _, file := range s.skipOpenElsewhere(s.excludeProtected(files)) {
+			if active[file.Name] {
+				continue
+			}
+			if owner, ok := owners[file.Name]; ok && len(owner.appender.state.namePrefix) >= len(s.namePrefix) {
+				continue
+			}
+			owners[file.Name] = owned
+		}
+	}
+
+	for i, owned := range all {
+		for _, file := range listed[i] {
+			if owners[file.Name] != owned {
+				continue
+			}
+
+			size := owned.appender.state.entryInfo(file).Size
+			owned.files = append(owned.files, file)
+			owned.sizes = append(owned.sizes, size)
+			owned.total += size
+		}
+	}
+
+	var removed []string
+	for _, owned := range all {
+		for owned.quota > 0 && owned.total > owned.quota {
+			name, ok := owned.removeOldest()
+			if !ok {
+				break
+			}
+			removed = append(removed, name)
+		}
+	}
+
+	if m.budget > 0 {
+		removed = append(removed, m.pruneToBudget(all)...)
+	}
+
+	return removed, nil
+}
+
+// pruneToBudget removes files from the appenders furthest over their share
+// until the total fits the budget.
+func (m *DirectoryManager) pruneToBudget(all []*managedFiles) []string {
+	var total, weights int64
+	for _, owned := range all {
+		total += owned.total
+		weights += owned.weight(m.budget, len(all))
+	}
+	if total <= m.budget || weights == 0 {
+		return nil
+	}
+
+	for _, owned := range all {
+		owned.share = int64(float64(m.budget) * float64(owned.weight(m.budget, len(all))) / float64(weights))
+	}
+
+	var removed []string
+	for total > m.budget {
+		var over *managedFiles
+		for _, owned := range all {
+			if len(owned.files) > 0 && (over == nil || owned.total-owned.share > over.total-over.share) {
+				over = owned
+			}
+		}
+		if over == nil {
+			break
+		}
+
+		before := over.total
+		if name, ok := over.removeOldest(); ok {
+			removed = append(removed, name)
+			total -= before - over.total
+		}
+	}
+
+	return removed
+}
+
+func (f *managedFiles) weight(budget int64, members int) int64 {
+	if f.quota > 0 {
+		return f.quota
+	}
+
+	return budget / int64(members)
+}
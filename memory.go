@@ -0,0 +1,113 @@
+package rolling
+
+import (
+	"os"
+	"strconv"
+	"sync"
+)
+
+// MemoryAppender is an Appender that keeps its files in memory, for
+// asserting on logging in unit tests. Files are named "memory",
+// "memory.1" and so on, and only Rotate starts a new one.
+type MemoryAppender struct {
+	mu     sync.Mutex
+	names  []string
+	files  map[string][]byte
+	closed bool
+}
+
+var _ Appender = (*MemoryAppender)(nil)
+
+func NewMemoryAppender() *MemoryAppender {
+	return &MemoryAppender{
+		names: []string{"memory"},
+		files: map[string][]byte{"memory": nil},
+	}
+}
+
+func (m *MemoryAppender) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return 0, os.ErrClosed
+	}
+
+	name := m.names[len(m.names)-1]
+	m.files[name] = append(m.files[name], p...)
+
+	return len(p), nil
+}
+
+func (m *MemoryAppender) Sync() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return os.ErrClosed
+	}
+
+	return nil
+}
+
+func (m *MemoryAppender) Rotate() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return os.ErrClosed
+	}
+
+	name := "memory." + strconv.Itoa(len(m.names))
+	m.names = append(m.names, name)
+	m.files[name] = nil
+
+	return nil
+}
+
+func (m *MemoryAppender) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return os.ErrClosed
+	}
+	m.closed = true
+
+	return nil
+}
+
+func (m *MemoryAppender) CurrentFilename() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return ""
+	}
+
+	return m.names[len(m.names)-1]
+}
+
+// Files returns the names of the files, oldest first.
+func (m *MemoryAppender) Files() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]string(nil), m.names...)
+}
+
+// Contents returns a copy of what was written to the named file.
+func (m *MemoryAppender) Contents(name string) []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]byte(nil), m.files[name]...)
+}
+
+// Rotations returns the number of rotations so far.
+func (m *MemoryAppender) Rotations() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.names) - 1
+}
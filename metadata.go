@@ -0,0 +1,80 @@
+package rolling
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"time"
+)
+
+// MetadataMode selects how rotated files are stamped with their metadata.
+type MetadataMode int8
+
+const (
+	MetadataOff MetadataMode = iota
+	// MetadataXattr sets the extended attributes user.rolling.period_start,
+	// user.rolling.period_end, user.rolling.host and
+	// user.rolling.app_version. It is only supported on Linux.
+	MetadataXattr
+	// MetadataSidecar writes the metadata as JSON next to the file, under
+	// its name followed by ".meta". Pruning removes it with the file.
+	MetadataSidecar
+)
+
+const metadataExt = ".meta"
+
+var ErrXattrUnsupported = errors.New("rolling: extended attributes are not supported on this platform")
+
+// FileMetadata describes a rotated file, for downstream indexing.
+type FileMetadata struct {
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+	Host        string    `json:"host"`
+	AppVersion  string    `json:"app_version,omitempty"`
+}
+
+func (s *state) stampMetadata(file FileInfo) {
+	meta := FileMetadata{
+		PeriodStart: file.PeriodStart,
+		PeriodEnd:   file.PeriodEnd,
+		Host:        s.host,
+		AppVersion:  s.appVersion,
+	}
+
+	var err error
+	switch s.metadata {
+	case MetadataXattr:
+		err = setXattrs(file.Path, map[string]string{
+			"user.rolling.period_start": meta.PeriodStart.Format(time.RFC3339Nano),
+			"user.rolling.period_end":   meta.PeriodEnd.Format(time.RFC3339Nano),
+			"user.rolling.host":         meta.Host,
+			"user.rolling.app_version":  meta.AppVersion,
+		})
+
+	case MetadataSidecar:
+		var content []byte
+		if content, err = json.Marshal(meta); err == nil {
+			err = writeFileAtomic(file.Path+metadataExt, append(content, '\n'), s.fileMode)
+		}
+	}
+
+	if err != nil {
+		s.logError("failed to stamp the log file metadata", err, "file", file.Name)
+	}
+}
+
+// removeMetadata removes the sidecar of a pruned file.
+func (s *state) removeMetadata(fullPath string) {
+	if s.metadata != MetadataSidecar {
+		return
+	}
+
+	if err := os.Remove(fullPath + metadataExt); err != nil && !os.IsNotExist(err) {
+		s.logError("failed to remove the log file metadata", err)
+	}
+}
+
+func (s *state) isSidecar(filename string) bool {
+	return s.metadata == MetadataSidecar && strings.HasSuffix(filename, metadataExt)
+}
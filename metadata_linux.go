@@ -0,0 +1,18 @@
+//go:build linux
+// +build linux
+
+package rolling
+
+import "syscall"
+
+const xattrSupported = true
+
+func setXattrs(path string, attrs map[string]string) error {
+	for name, value := range attrs {
+		if err := syscall.Setxattr(path, name, []byte(value), 0); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package rolling
+
+const xattrSupported = false
+
+func setXattrs(path string, attrs map[string]string) error {
+	return ErrXattrUnsupported
+}
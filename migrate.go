@@ -0,0 +1,151 @@
+package rolling
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// MigrateNaming renames the log files named after the config from, e.g. a
+// previous FilenamePrefix or DateFormat, to the names the config to gives
+// them, so that retention keeps managing them after a naming change. Files
+// keep their subdirectory and archive extensions, and their metadata
+// sidecars follow them. A file whose new name is taken is left alone. With
+// Upload in from, the upload queue is carried over to the new names; with
+// PersistIndex, the file indexes are dropped, to be rebuilt by the next
+// scan. Configs with NoDelete are
+// refused, since renaming needs the permission to delete. It returns the
+// new names of the renamed files.
+func MigrateNaming(from, to Config) ([]string, error) {
+	if from.NoDelete || to.NoDelete {
+		return nil, errors.New("rolling: MigrateNaming cannot rename files with NoDelete")
+	}
+
+	old, err := newState(from)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := newState(to)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	if err := old.walkLogs(func(name string) {
+		names = append(names, name)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to read dir: %w", err)
+	}
+
+	var renamed, moved []string
+	defer func() {
+		old.syncDir = s.syncDir
+		old.syncParents(moved)
+		s.syncParents(renamed)
+	}()
+
+	newNames := make(map[string]string)
+	defer func() {
+		if from.Upload != nil {
+			if err := migrateUploadQueue(old, s, newNames); err != nil {
+				s.logError("failed to migrate the upload queue", err)
+			}
+		}
+		if from.PersistIndex {
+			dropIndex(old)
+		}
+		if to.PersistIndex {
+			dropIndex(s)
+		}
+	}()
+
+	for _, name := range names {
+		date, seq, ok := old.parseFilename(name)
+		if !ok {
+			continue
+		}
+
+		stem, _ := trimArchiveExt(name)
+		newName := path.Join(path.Dir(name), s.joinDate(date, seq)+name[len(stem):])
+		if newName == name || s.reserved[path.Base(newName)] {
+			continue
+		}
+
+		target := path.Join(s.logDirectory, newName)
+		if _, err := os.Lstat(target); !errors.Is(err, fs.ErrNotExist) {
+			s.logError("not renaming the log file", fs.ErrExist, "file", name, "target", newName)
+			continue
+		}
+
+		if err := os.MkdirAll(path.Dir(target), 0755); err != nil {
+			return renamed, err
+		}
+		source := path.Join(old.logDirectory, name)
+		if err := os.Rename(source, target); err != nil {
+			return renamed, err
+		}
+		renamed = append(renamed, newName)
+		moved = append(moved, name)
+		newNames[name] = newName
+
+		if err := os.Rename(source+metadataExt, target+metadataExt); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			s.logError("failed to rename the log file metadata", err, "file", name)
+		}
+	}
+
+	return renamed, nil
+}
+
+// migrateUploadQueue moves the upload queue of old to the queue file of s,
+// with the files renamed to their names in newNames.
+func migrateUploadQueue(old, s *state, newNames map[string]string) error {
+	source := path.Join(old.logDirectory, old.uploadQueueFilename())
+	content, err := os.ReadFile(source)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	target := path.Join(s.logDirectory, s.uploadQueueFilename())
+	var queue []byte
+	if target != source {
+		// Appended to the queue of s, should it have one already.
+		if queue, err = os.ReadFile(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	for _, name := range strings.Split(string(content), "\n") {
+		if len(name) == 0 {
+			continue
+		}
+		if newName, ok := newNames[name]; ok {
+			name = newName
+		}
+		queue = append(queue, name+"\n"...)
+	}
+
+	if err := writeFileAtomic(target, queue, s.fileMode); err != nil {
+		return err
+	}
+	if target != source {
+		return os.Remove(source)
+	}
+
+	return nil
+}
+
+// dropIndex removes the persisted file index of s, which lists the old
+// names.
+func dropIndex(s *state) {
+	err := os.Remove(path.Join(s.logDirectory, s.indexFilename()))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		s.logError("failed to remove the file index", err, "file", s.indexFilename())
+	}
+}
@@ -0,0 +1,30 @@
+package rolling
+
+import (
+	"io"
+	"os"
+)
+
+const mmapChunkSize = 4 << 20
+
+// mmapDataSize returns the size of the data in a file written through a
+// memory mapping, without the zeros of a last chunk that was not truncated
+// because the process died.
+func mmapDataSize(file *os.File, size int64) (int64, error) {
+	start := size - mmapChunkSize
+	if start < 0 {
+		start = 0
+	}
+
+	buf := make([]byte, size-start)
+	if _, err := file.ReadAt(buf, start); err != nil && err != io.EOF {
+		return 0, err
+	}
+
+	n := len(buf)
+	for n > 0 && buf[n-1] == 0 {
+		n--
+	}
+
+	return start + int64(n), nil
+}
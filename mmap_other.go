@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package rolling
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+const mmapSupported = false
+
+func newMmapWriter(file *os.File, size int64) (io.WriteCloser, error) {
+	return nil, errors.New("rolling: memory mapped files are not supported on this platform")
+}
@@ -0,0 +1,136 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package rolling
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const mmapSupported = true
+
+// mmapWriter appends to a file through a shared memory mapping that grows
+// the file a chunk at a time. A full chunk is scheduled for writeback with
+// msync(MS_ASYNC) before the next one is mapped, and Close truncates the
+// file to the bytes actually written.
+type mmapWriter struct {
+	mu   sync.Mutex
+	file *os.File
+	data []byte
+	base int64
+	n    int
+}
+
+func newMmapWriter(file *os.File, size int64) (*mmapWriter, error) {
+	// Mappings start at page boundaries.
+	page := int64(os.Getpagesize())
+	w := &mmapWriter{
+		file: file,
+		base: size &^ (page - 1),
+		n:    int(size % page),
+	}
+
+	if err := w.mmap(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *mmapWriter) mmap() error {
+	if err := w.file.Truncate(w.base + mmapChunkSize); err != nil {
+		return err
+	}
+
+	data, err := syscall.Mmap(int(w.file.Fd()), w.base, mmapChunkSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return os.NewSyscallError("mmap", err)
+	}
+	w.data = data
+
+	return nil
+}
+
+func (w *mmapWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	written := 0
+	for len(p) > 0 {
+		if w.n == len(w.data) {
+			if err := w.next(); err != nil {
+				return written, err
+			}
+		}
+
+		c := copy(w.data[w.n:], p)
+		w.n += c
+		written += c
+		p = p[c:]
+	}
+
+	return written, nil
+}
+
+// next replaces the full mapping with one of the following chunk.
+func (w *mmapWriter) next() error {
+	if err := msync(w.data, syscall.MS_ASYNC); err != nil {
+		return err
+	}
+	if err := syscall.Munmap(w.data); err != nil {
+		return os.NewSyscallError("munmap", err)
+	}
+
+	w.base += int64(len(w.data))
+	w.data, w.n = nil, 0
+
+	return w.mmap()
+}
+
+// Flush writes the mapped data to the file and waits for it.
+func (w *mmapWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.data == nil {
+		return os.ErrClosed
+	}
+
+	return msync(w.data[:w.n], syscall.MS_SYNC)
+}
+
+func (w *mmapWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.data != nil {
+		if err := syscall.Munmap(w.data); err != nil {
+			w.file.Close()
+			return os.NewSyscallError("munmap", err)
+		}
+		w.data = nil
+	}
+
+	if err := w.file.Truncate(w.base + int64(w.n)); err != nil {
+		w.file.Close()
+		return err
+	}
+
+	return w.file.Close()
+}
+
+func msync(data []byte, flags int) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_MSYNC, uintptr(unsafe.Pointer(&data[0])), uintptr(len(data)), uintptr(flags))
+	if errno != 0 {
+		return os.NewSyscallError("msync", errno)
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package rolling
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// deletionsFilename names the manifest of the files NoDelete leaves to an
+// external cleaner.
+func (s *state) deletionsFilename() string {
+	return s.logFilenamePrefix + "deletions" + s.logFilenameSuffix
+}
+
+// checkNoDelete rejects the options that rename or remove files, which
+// NoDelete and AuditMode, named by option, rule out.
+func checkNoDelete(config Config, option string) error {
+	var conflicts []string
+	if config.Compress {
+		conflicts = append(conflicts, "Compress")
+	}
+	if config.TempFiles != TempFilesOff {
+		conflicts = append(conflicts, "TempFiles")
+	}
+	if config.OrphanRecovery != OrphanKeep {
+		conflicts = append(conflicts, "OrphanRecovery")
+	}
+	if config.WritePidFile {
+		conflicts = append(conflicts, "WritePidFile")
+	}
+	if config.Upload != nil {
+		conflicts = append(conflicts, "Upload")
+	}
+	if config.PersistIndex {
+		conflicts = append(conflicts, "PersistIndex")
+	}
+	if config.Metadata == MetadataSidecar {
+		conflicts = append(conflicts, "MetadataSidecar")
+	}
+
+	if len(conflicts) > 0 {
+		return fmt.Errorf("rolling: %s cannot be combined with %s", option, strings.Join(conflicts, ", "))
+	}
+
+	return nil
+}
+
+// loadDeletions reads back the manifest of an earlier run, so that the
+// files it lists still do not count towards the retention.
+func (s *state) loadDeletions() error {
+	file, err := os.Open(path.Join(s.logDirectory, s.deletionsFilename()))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	dir, err := filepath.Abs(s.logDirectory)
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		name, err := filepath.Rel(dir, scanner.Text())
+		if err != nil || strings.HasPrefix(name, "..") {
+			continue
+		}
+		s.pendingRemovals[filepath.ToSlash(name)] = struct{}{}
+	}
+
+	return scanner.Err()
+}
+
+// requestDeletion appends the absolute path of file to the manifest
+// instead of removing it. It returns the empty string once the file is
+// listed.
+func (s *state) requestDeletion(file *logEntry) string {
+	if _, ok := s.pendingRemovals[file.Name]; ok {
+		return ""
+	}
+
+	full, err := filepath.Abs(file.FullPath)
+	if err != nil {
+		return "failed to list for deletion: " + err.Error()
+	}
+
+	manifest, err := os.OpenFile(path.Join(s.logDirectory, s.deletionsFilename()), os.O_WRONLY|os.O_APPEND|os.O_CREATE, s.fileMode)
+	if err == nil {
+		_, err = manifest.WriteString(full + "\n")
+		if closeErr := manifest.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		s.logError("failed to list the log file for deletion", err, "file", file.Name)
+		return "failed to list for deletion: " + err.Error()
+	}
+
+	s.pendingRemovals[file.Name] = struct{}{}
+	s.logEvent("listed the log file for deletion", "file", file.Name)
+
+	return ""
+}
+
+// forgetDeleted drops the files the external cleaner has removed from the
+// pending removals.
+func (s *state) forgetDeleted() {
+	for name := range s.pendingRemovals {
+		if _, err := os.Lstat(path.Join(s.logDirectory, name)); errors.Is(err, fs.ErrNotExist) {
+			delete(s.pendingRemovals, name)
+			s.births.forget(name)
+			s.indexRemoved(name, "")
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package rolling
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// OrphanPolicy decides what New does with the temporary files a crashed
+// run left behind: files still under their TempFiles name and the
+// ".gz.partial" files of an interrupted compression.
+type OrphanPolicy int8
+
+const (
+	// OrphanKeep leaves them alone.
+	OrphanKeep OrphanPolicy = iota
+	// OrphanFinish renames temporary files into place, removing the empty
+	// ones and leaving those whose name is taken, and removes partial
+	// archives, whose originals are still there to be compressed again.
+	OrphanFinish
+	// OrphanRemove removes them.
+	OrphanRemove
+)
+
+const partialExt = ".gz.partial"
+
+// recoverOrphans applies OrphanRecovery to the leftovers of the
+// appender's own files.
+func (s *state) recoverOrphans() {
+	if s.orphans == OrphanKeep {
+		return
+	}
+
+	var orphans []string
+	err := s.walkFiles(func(filename string) bool {
+		return strings.HasSuffix(filename, tempExt) || strings.HasSuffix(filename, partialExt)
+	}, func(name string) {
+		orphans = append(orphans, name)
+	})
+	if err != nil {
+		s.logError("failed to look for orphaned files", err)
+		return
+	}
+
+	for _, name := range orphans {
+		target, ok := s.orphanOf(name)
+		if !ok {
+			continue
+		}
+		full := path.Join(s.logDirectory, name)
+
+		if s.orphans == OrphanFinish && strings.HasSuffix(name, tempExt) {
+			if info, err := os.Stat(full); err == nil && info.Size() > 0 {
+				s.finishOrphan(name, target)
+				continue
+			}
+		}
+
+		if err := os.Remove(full); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			s.logError("failed to remove the orphaned file", err, "file", name)
+		} else {
+			s.logEvent("removed the orphaned file", "file", name)
+		}
+	}
+}
+
+// orphanOf returns the name of the log file name is a leftover of.
+func (s *state) orphanOf(name string) (string, bool) {
+	for _, ext := range []string{partialExt, tempExt} {
+		if stem := strings.TrimSuffix(name, ext); stem != name {
+			_, _, ok := s.parseFilename(stem)
+			return stem, ok && !s.reserved[path.Base(stem)]
+		}
+	}
+
+	return "", false
+}
+
+// finishOrphan renames the temporary file name to target, unless target
+// exists.
+func (s *state) finishOrphan(name, target string) {
+	full, targetPath := path.Join(s.logDirectory, name), path.Join(s.logDirectory, target)
+	if _, err := os.Lstat(targetPath); !errors.Is(err, fs.ErrNotExist) {
+		s.logError("not recovering the orphaned file", fs.ErrExist, "file", name, "target", target)
+		return
+	}
+
+	if err := os.Rename(full, targetPath); err != nil {
+		s.logError("failed to recover the orphaned file", err, "file", name)
+		return
+	}
+	s.logEvent("recovered the orphaned file", "file", name)
+}
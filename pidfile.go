@@ -0,0 +1,45 @@
+package rolling
+
+import (
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// pidFilename is the name of the WritePidFile file, the prefix without its
+// trailing separators and ".pid", as in "app.pid".
+func (s *state) pidFilename() string {
+	name := strings.TrimRight(s.logFilenamePrefix, "-_.")
+	if len(name) == 0 {
+		name = "rolling"
+	}
+
+	return name + ".pid"
+}
+
+// writePidFile records the PID of the process and the name of the active
+// file, replacing the file atomically so that readers never see it half
+// written.
+func (s *state) writePidFile(active string) {
+	content := strconv.Itoa(os.Getpid()) + "\n" + active + "\n"
+	if err := writeFileAtomic(path.Join(s.logDirectory, s.pidFilename()), []byte(content), s.fileMode); err != nil {
+		s.logError("failed to write the pid file", err)
+	}
+}
+
+func (s *state) removePidFile() {
+	if err := os.Remove(path.Join(s.logDirectory, s.pidFilename())); err != nil && !os.IsNotExist(err) {
+		s.logError("failed to remove the pid file", err)
+	}
+}
+
+// writeFileAtomic replaces name with data through a temporary file.
+func writeFileAtomic(name string, data []byte, mode os.FileMode) error {
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, mode); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, name)
+}
@@ -0,0 +1,51 @@
+package rolling
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// RedirectCmd sends the output of cmd to the appender. Stdout and Stderr
+// are replaced only when nil. exec copies the output through a pipe while
+// the command runs, so rotations happen as for any other write; Wait
+// returns once the copying is done.
+func (r *RollingFileAppender) RedirectCmd(cmd *exec.Cmd) {
+	if cmd.Stdout == nil {
+		cmd.Stdout = r
+	}
+	if cmd.Stderr == nil {
+		cmd.Stderr = r
+	}
+}
+
+// Pipe returns the write end of a pipe whose data is copied into the
+// appender, for writers that need a file descriptor. done closes w and
+// waits for the copying, which ends when every other copy of the
+// descriptor, such as those of child processes, is closed too.
+func (r *RollingFileAppender) Pipe() (w *os.File, done func() error, err error) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	copied := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(r, pr)
+		pr.Close()
+		copied <- err
+	}()
+
+	var once sync.Once
+	var copyErr error
+	done = func() error {
+		once.Do(func() {
+			pw.Close()
+			copyErr = <-copied
+		})
+		return copyErr
+	}
+
+	return pw, done, nil
+}
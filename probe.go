@@ -0,0 +1,71 @@
+package rolling
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+	"strconv"
+)
+
+// Probe checks the config against the real filesystem, so that a service
+// can fail at startup rather than lose its logs later: it creates a
+// temporary file in Directory with FileMode, writes and syncs it, creates
+// a second one as a rotation would, and removes both. The appender's own
+// files are left alone.
+func (c Config) Probe() error {
+	s, err := newState(c)
+	if err != nil {
+		return err
+	}
+
+	if s.createDir {
+		if err := os.MkdirAll(s.logDirectory, 0755); err != nil {
+			return fmt.Errorf("rolling: probe: %w", err)
+		}
+	}
+
+	base := "." + s.logFilenamePrefix + "probe-" + strconv.Itoa(os.Getpid())
+	for _, name := range []string{base, base + ".1"} {
+		if err := s.probeFile(name); err != nil {
+			return fmt.Errorf("rolling: probe: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *state) probeFile(name string) error {
+	file, err := s.openLogFile(name, 0)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path.Join(s.logDirectory, name))
+
+	_, err = file.Write([]byte("rolling probe\n"))
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(path.Join(s.logDirectory, name))
+	if err != nil {
+		return err
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != s.fileMode.Perm() {
+		return fmt.Errorf("%s has mode %v instead of %v", name, info.Mode().Perm(), s.fileMode.Perm())
+	}
+
+	if s.syncDir {
+		if err := syncDir(s.logDirectory); err != nil {
+			return err
+		}
+	}
+
+	return os.Remove(path.Join(s.logDirectory, name))
+}
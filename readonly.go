@@ -0,0 +1,118 @@
+package rolling
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"time"
+)
+
+const followInterval = 250 * time.Millisecond
+
+// ReadOnly accesses the files of an appender without ever creating or
+// writing one, for sidecar processes, such as log shippers, sharing the
+// configuration of the application that writes them.
+type ReadOnly struct {
+	state *state
+}
+
+// OpenReadOnly returns a ReadOnly for the files of the config. Unlike New
+// it neither creates a file nor claims the directory.
+func OpenReadOnly(config Config) (*ReadOnly, error) {
+	state, err := newState(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReadOnly{state: state}, nil
+}
+
+// List returns the names of the log files, oldest first.
+func (r *ReadOnly) List() ([]string, error) {
+	return (&RollingFileAppender{state: r.state}).Files()
+}
+
+// Prune removes the log files the retention does not keep and returns
+// their names.
+func (r *ReadOnly) Prune() ([]string, error) {
+	return r.state.prune_old_logs(false, "")
+}
+
+// Follow copies what is appended to the newest uncompressed file to w, as
+// tail -f does, moving on to each new file once the writer rotates. It
+// starts at the end of the current file and returns when ctx is done.
+func (r *ReadOnly) Follow(ctx context.Context, w io.Writer) error {
+	ticker := time.NewTicker(followInterval)
+	defer ticker.Stop()
+
+	var name string
+	var file *os.File
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
+
+	for first := true; ; first = false {
+		if file != nil {
+			if _, err := io.Copy(w, file); err != nil {
+				return err
+			}
+		}
+
+		newest, err := r.newest()
+		if err != nil {
+			return err
+		}
+
+		if newest != name && len(newest) > 0 {
+			next, err := os.Open(path.Join(r.state.logDirectory, newest))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+
+			if next != nil {
+				if first {
+					if _, err := next.Seek(0, io.SeekEnd); err != nil {
+						next.Close()
+						return err
+					}
+				}
+
+				if file != nil {
+					// Catch up with what was written before the rotation.
+					if _, err := io.Copy(w, file); err != nil {
+						next.Close()
+						return err
+					}
+					file.Close()
+				}
+				name, file = newest, next
+				continue
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// newest returns the name of the newest uncompressed file, if there is one.
+func (r *ReadOnly) newest() (string, error) {
+	files, err := r.state.listLogs()
+	if err != nil {
+		return "", err
+	}
+
+	for i := len(files) - 1; i >= 0; i-- {
+		if _, archived := trimArchiveExt(files[i].Name); !archived {
+			return files[i].Name, nil
+		}
+	}
+
+	return "", nil
+}
@@ -0,0 +1,111 @@
+package rolling
+
+import (
+	"fmt"
+	"os"
+	"path"
+)
+
+// PruneReport is the outcome of ReconcileRetention.
+type PruneReport struct {
+	Kept    []FileInfo
+	Removed []FileInfo
+	Skipped []SkippedFile
+}
+
+// SkippedFile is a file the retention does not keep that was not removed.
+type SkippedFile struct {
+	File   FileInfo
+	Reason string
+}
+
+// ReconcileRetention reads the whole directory, bypassing IndexFiles and
+// the cap on the files a pruning pass stats, applies the retention and
+// reports what it kept, removed and left alone, and why, for a periodic
+// maintenance job. Files without a birth time are reported as skipped.
+func (r *RollingFileAppender) ReconcileRetention() (PruneReport, error) {
+	h := r.file.Load()
+	if h == nil {
+		return PruneReport{}, os.ErrClosed
+	}
+
+	return r.state.reconcile(h.name)
+}
+
+func (s *state) reconcile(active string) (PruneReport, error) {
+	s.pruneMu.Lock()
+	defer s.pruneMu.Unlock()
+
+	var report PruneReport
+	for _, name := range s.retryRemovals() {
+		report.Removed = append(report.Removed, FileInfo{Path: path.Join(s.logDirectory, name), Name: name})
+	}
+
+	files, _, err := s.readLogs(0)
+	if err != nil {
+		return report, fmt.Errorf("failed to read dir: %w", err)
+	}
+
+	listed := make(map[string]bool, len(files))
+	for _, file := range files {
+		listed[file.Name] = true
+	}
+	s.walkLogs(func(name string) {
+		if !listed[name] {
+			report.Skipped = append(report.Skipped, SkippedFile{s.fileInfo(name), "no birth time"})
+		}
+	})
+
+	counted := make([]*logEntry, 0, len(files))
+	for _, file := range files {
+		_, pending := s.pendingRemovals[file.Name]
+		switch {
+		case s.protected(file.Name):
+			report.Skipped = append(report.Skipped, SkippedFile{s.fileInfo(file.Name), "excluded by PruneExclude"})
+		case pending:
+			report.Skipped = append(report.Skipped, SkippedFile{s.fileInfo(file.Name), "pending removal"})
+		default:
+			counted = append(counted, file)
+		}
+	}
+
+	var drop []*logEntry
+	if s.retention != nil && !s.audit {
+		drop = s.unretained(counted, s.retention, false)
+	}
+	dropped := make(map[*logEntry]bool, len(drop))
+	for _, file := range drop {
+		dropped[file] = true
+	}
+	for _, file := range counted {
+		if !dropped[file] {
+			report.Kept = append(report.Kept, s.fileInfo(file.Name))
+		}
+	}
+
+	closed := make(map[*logEntry]bool, len(drop))
+	for _, file := range s.skipOpenElsewhere(drop) {
+		closed[file] = true
+	}
+
+	var removed []string
+	for _, file := range drop {
+		info := s.fileInfo(file.Name)
+		switch {
+		case file.Name == active:
+			report.Skipped = append(report.Skipped, SkippedFile{info, "active file"})
+		case !closed[file]:
+			report.Skipped = append(report.Skipped, SkippedFile{info, "open in another process"})
+		default:
+			if reason := s.deleteLog(file); len(reason) > 0 {
+				report.Skipped = append(report.Skipped, SkippedFile{info, reason})
+			} else {
+				report.Removed = append(report.Removed, info)
+				removed = append(removed, file.Name)
+			}
+		}
+	}
+	s.syncParents(removed)
+
+	return report, nil
+}
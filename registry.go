@@ -0,0 +1,133 @@
+package rolling
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var ErrConflictingAppender = errors.New("rolling: another appender of this process writes the same files")
+
+// appenders holds the files claimed by the open appenders of the process.
+var appenders = struct {
+	sync.Mutex
+	claimed map[*state]claim
+}{claimed: make(map[*state]claim)}
+
+// claim describes the files of an appender: those it names, and those its
+// prefix and suffix match when it lists the directory.
+type claim struct {
+	dir         string
+	namePrefix  string
+	matchPrefix string
+	suffix      string
+	// narrowed is set when PruneGlob or PruneRegexp choose the listed
+	// files instead of the prefix and suffix.
+	narrowed bool
+	manager  *DirectoryManager
+}
+
+func (s *state) claimOf() claim {
+	dir, err := filepath.Abs(s.logDirectory)
+	if err != nil {
+		dir = s.logDirectory
+	}
+
+	return claim{
+		dir:         filepath.Clean(dir),
+		namePrefix:  s.namePrefix,
+		matchPrefix: s.logFilenamePrefix,
+		suffix:      s.logFilenameSuffix,
+		narrowed:    len(s.pruneGlob) > 0 || s.pruneRegexp != nil,
+		manager:     s.manager,
+	}
+}
+
+// covers reports whether the files named for o are listed, and so rotated
+// and pruned, by c, as those of "app-http" are by "app".
+func (c claim) covers(o claim) bool {
+	return !c.narrowed &&
+		strings.HasPrefix(o.namePrefix, c.matchPrefix) &&
+		strings.HasSuffix(o.suffix, c.suffix)
+}
+
+func (c claim) sameNames(o claim) bool {
+	return c.namePrefix == o.namePrefix && c.suffix == o.suffix
+}
+
+// names reports whether the file stem is named for c.
+func (c claim) names(stem string) bool {
+	return strings.HasPrefix(stem, c.namePrefix) && strings.HasSuffix(stem, c.suffix)
+}
+
+func (c claim) conflicts(o claim) bool {
+	if c.dir != o.dir {
+		return false
+	}
+
+	if c.sameNames(o) {
+		return true
+	}
+
+	if c.manager != nil && c.manager == o.manager {
+		// The shorter prefix yields the files of the longer one.
+		return false
+	}
+
+	return c.covers(o) || o.covers(c)
+}
+
+// claim reserves the files of s for one appender, so that two appenders
+// do not rotate and prune the same files. Appenders sharing a directory
+// must not list each other's files either: one prefix extending another,
+// as "app" and "app-http" do, conflicts unless the shorter one's files are
+// chosen with PruneGlob or PruneRegexp, or both appenders belong to the
+// same DirectoryManager, where the shorter one leaves out the longer one's
+// files.
+func (s *state) claim() error {
+	c := s.claimOf()
+
+	appenders.Lock()
+	defer appenders.Unlock()
+
+	for _, other := range appenders.claimed {
+		if c.conflicts(other) {
+			return ErrConflictingAppender
+		}
+	}
+	appenders.claimed[s] = c
+
+	return nil
+}
+
+// yields reports whether the file stem, which s matches, is named for
+// another appender of its DirectoryManager whose names s covers.
+func (s *state) yields(stem string) bool {
+	if s.manager == nil {
+		return false
+	}
+
+	appenders.Lock()
+	defer appenders.Unlock()
+
+	c, ok := appenders.claimed[s]
+	if !ok {
+		return false
+	}
+
+	for other, o := range appenders.claimed {
+		if other != s && o.manager == s.manager && !c.sameNames(o) && c.covers(o) && o.names(stem) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *state) unclaim() {
+	appenders.Lock()
+	defer appenders.Unlock()
+
+	delete(appenders.claimed, s)
+}
@@ -0,0 +1,79 @@
+package rolling_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/importcjj/rolling"
+	"github.com/importcjj/rolling/rollingtest"
+)
+
+func newAppender(t *testing.T, config rolling.Config) (*rolling.RollingFileAppender, error) {
+	t.Helper()
+
+	config.Rotation = rolling.Daily
+	config.Clock = rollingtest.NewClock(rollingtest.Start)
+	config.DisableBirthTime = true
+
+	a, err := rolling.New(config)
+	if err == nil {
+		t.Cleanup(func() { a.Close() })
+	}
+
+	return a, err
+}
+
+func TestOverlappingPrefixesConflict(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := newAppender(t, rolling.Config{Directory: dir, FilenamePrefix: "app"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		config rolling.Config
+		want   error
+	}{
+		{rolling.Config{Directory: dir, FilenamePrefix: "app"}, rolling.ErrConflictingAppender},
+		{rolling.Config{Directory: dir, FilenamePrefix: "app-http"}, rolling.ErrConflictingAppender},
+		{rolling.Config{Directory: dir, FilenamePrefix: "api"}, nil},
+		{rolling.Config{Directory: t.TempDir(), FilenamePrefix: "app-http"}, nil},
+	} {
+		if _, err := newAppender(t, tt.config); !errors.Is(err, tt.want) {
+			t.Errorf("prefix %q: got %v, want %v", tt.config.FilenamePrefix, err, tt.want)
+		}
+	}
+}
+
+func TestManagerOverlappingPrefixes(t *testing.T) {
+	m := rolling.NewDirectoryManager(t.TempDir(), 0)
+
+	var appenders []*rolling.RollingFileAppender
+	for _, prefix := range []string{"app", "app-http"} {
+		a, err := m.New(rolling.Config{
+			Rotation:         rolling.Daily,
+			FilenamePrefix:   prefix,
+			Clock:            rollingtest.NewClock(rollingtest.Start),
+			DisableBirthTime: true,
+		}, 0)
+		if err != nil {
+			t.Fatalf("prefix %q: %v", prefix, err)
+		}
+		t.Cleanup(func() { a.Close() })
+
+		if _, err := a.Write([]byte(prefix + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		appenders = append(appenders, a)
+	}
+
+	for i, want := range []string{"app", "app-http"} {
+		names, err := appenders[i].Files()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(names) != 1 || !strings.HasPrefix(names[0], want) || want == "app" && strings.HasPrefix(names[0], "app-http") {
+			t.Errorf("appender %q lists %q", want, names)
+		}
+	}
+}
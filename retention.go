@@ -0,0 +1,192 @@
+package rolling
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"time"
+)
+
+// RetentionPolicy decides which log files to keep. Retain is given the
+// files oldest first and reports for each of them whether it is kept.
+type RetentionPolicy interface {
+	Retain(files []FileInfo, now time.Time) []bool
+}
+
+// Retainer is implemented by integrations that need files to stay around,
+// e.g. until they are shipped. Pruning removes a file only if every
+// Retainer allows it, so retention never gets ahead of them. Files kept
+// this way still count towards the retention.
+type Retainer interface {
+	MayDelete(path string) bool
+}
+
+type retentionFunc func(files []FileInfo, now time.Time) []bool
+
+func (f retentionFunc) Retain(files []FileInfo, now time.Time) []bool {
+	return f(files, now)
+}
+
+// KeepLastN keeps the n newest files.
+func KeepLastN(n int) RetentionPolicy {
+	return retentionFunc(func(files []FileInfo, now time.Time) []bool {
+		keep := make([]bool, len(files))
+		for i := range files {
+			keep[i] = i >= len(files)-n
+		}
+		return keep
+	})
+}
+
+// MaxAge keeps the files modified within d.
+func MaxAge(d time.Duration) RetentionPolicy {
+	return retentionFunc(func(files []FileInfo, now time.Time) []bool {
+		keep := make([]bool, len(files))
+		for i, file := range files {
+			keep[i] = now.Sub(file.ModTime) < d
+		}
+		return keep
+	})
+}
+
+// MaxTotalSize keeps the newest files that fit in size bytes together.
+func MaxTotalSize(size int64) RetentionPolicy {
+	return retentionFunc(func(files []FileInfo, now time.Time) []bool {
+		keep := make([]bool, len(files))
+		var total int64
+		for i := len(files) - 1; i >= 0; i-- {
+			total += files[i].Size
+			if total > size {
+				break
+			}
+			keep[i] = true
+		}
+		return keep
+	})
+}
+
+// And keeps the files that every policy keeps.
+func And(policies ...RetentionPolicy) RetentionPolicy {
+	return retentionFunc(func(files []FileInfo, now time.Time) []bool {
+		keep := make([]bool, len(files))
+		for i := range keep {
+			keep[i] = true
+		}
+
+		for _, policy := range policies {
+			for i, kept := range policy.Retain(files, now) {
+				keep[i] = keep[i] && kept
+			}
+		}
+		return keep
+	})
+}
+
+// Or keeps the files that any policy keeps.
+func Or(policies ...RetentionPolicy) RetentionPolicy {
+	return retentionFunc(func(files []FileInfo, now time.Time) []bool {
+		keep := make([]bool, len(files))
+		for _, policy := range policies {
+			for i, kept := range policy.Retain(files, now) {
+				keep[i] = keep[i] || kept
+			}
+		}
+		return keep
+	})
+}
+
+// MatchGlob applies policy to the files whose names match pattern, as in
+// path.Match, and keeps the others.
+func MatchGlob(pattern string, policy RetentionPolicy) RetentionPolicy {
+	return retentionFunc(func(files []FileInfo, now time.Time) []bool {
+		keep := make([]bool, len(files))
+		var matched []FileInfo
+		var index []int
+		for i, file := range files {
+			if ok, _ := path.Match(pattern, path.Base(file.Name)); ok {
+				matched = append(matched, file)
+				index = append(index, i)
+			} else {
+				keep[i] = true
+			}
+		}
+
+		for i, kept := range policy.Retain(matched, now) {
+			keep[index[i]] = kept
+		}
+		return keep
+	})
+}
+
+// Prune applies policy to the files in dir, ordered by modification time,
+// and removes those it does not retain. Use MatchGlob to limit it to the
+// log files of a directory shared with other files.
+func Prune(dir string, policy RetentionPolicy) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dir: %w", err)
+	}
+
+	var files []FileInfo
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		_, archived := trimArchiveExt(entry.Name())
+		files = append(files, FileInfo{
+			Path:       path.Join(dir, entry.Name()),
+			Name:       entry.Name(),
+			Size:       info.Size(),
+			ModTime:    info.ModTime(),
+			Compressed: archived,
+		})
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].ModTime.Before(files[j].ModTime)
+	})
+
+	var removed []string
+	for i, keep := range policy.Retain(files, time.Now()) {
+		if keep {
+			continue
+		}
+
+		if err := os.Remove(files[i].Path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, files[i].Name)
+	}
+
+	return removed, nil
+}
+
+// unretained returns the files, oldest first, that policy does not keep.
+// With reserve, the policy also sees an empty file created now, standing for
+// the file about to be created. The files are described as listed, not
+// stat-ed again.
+func (s *state) unretained(files []*logEntry, policy RetentionPolicy, reserve bool) []*logEntry {
+	infos := make([]FileInfo, len(files), len(files)+1)
+	for i, file := range files {
+		infos[i] = s.entryInfo(file)
+	}
+	if reserve {
+		infos = append(infos, FileInfo{ModTime: s.getNow()})
+	}
+
+	var drop []*logEntry
+	for i, keep := range policy.Retain(infos, s.getNow()) {
+		if !keep && i < len(files) {
+			drop = append(drop, files[i])
+		}
+	}
+
+	return drop
+}
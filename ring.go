@@ -0,0 +1,177 @@
+package rolling
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// ringHeaderSize is the size of the header of a ring buffer file: the
+// offset of the next write and whether the buffer has wrapped around.
+const ringHeaderSize = 16
+
+// RingBuffer keeps the last bytes written to it, for recovering the tail
+// of the log when the disk holding the log files fails. As
+// Config.RingBuffer it receives every write before the log file does. A
+// RingBuffer opened with OpenRingBuffer is backed by a file, which, on a
+// tmpfs such as /dev/shm, outlives a crash of the process.
+type RingBuffer struct {
+	mu   sync.Mutex
+	buf  []byte
+	off  int
+	full bool
+	file *os.File
+}
+
+// NewRingBuffer returns a ring buffer keeping the last size bytes in
+// memory.
+func NewRingBuffer(size int) *RingBuffer {
+	return &RingBuffer{buf: make([]byte, size)}
+}
+
+// OpenRingBuffer returns a ring buffer keeping the last size bytes in the
+// file name as well. The contents left in the file by a previous run,
+// which ReadRingBuffer returns, are discarded.
+func OpenRingBuffer(name string, size int) (*RingBuffer, error) {
+	file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := file.Truncate(int64(ringHeaderSize + size)); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &RingBuffer{buf: make([]byte, size), file: file}, nil
+}
+
+// ReadRingBuffer returns the contents of a ring buffer file written by
+// OpenRingBuffer, oldest first.
+func ReadRingBuffer(name string) ([]byte, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < ringHeaderSize {
+		return nil, errors.New("rolling: not a ring buffer file")
+	}
+
+	r := &RingBuffer{
+		buf:  data[ringHeaderSize:],
+		off:  int(binary.LittleEndian.Uint64(data)),
+		full: binary.LittleEndian.Uint64(data[8:]) != 0,
+	}
+	if r.off > len(r.buf) {
+		return nil, errors.New("rolling: corrupt ring buffer file")
+	}
+
+	return r.Bytes(), nil
+}
+
+// Write appends p, overwriting the oldest bytes once the buffer is full.
+// It always reports len(p) written; errors writing the file are dropped,
+// since the ring buffer is a fallback for when disks fail.
+func (r *RingBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(r.buf) == 0 {
+		return n, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(p) >= len(r.buf) {
+		p = p[len(p)-len(r.buf):]
+		r.off, r.full = 0, false
+	}
+
+	for len(p) > 0 {
+		m := copy(r.buf[r.off:], p)
+		if r.file != nil {
+			r.file.WriteAt(p[:m], int64(ringHeaderSize+r.off))
+		}
+		p = p[m:]
+
+		r.off += m
+		if r.off == len(r.buf) {
+			r.off, r.full = 0, true
+		}
+	}
+
+	if r.file != nil {
+		var header [ringHeaderSize]byte
+		binary.LittleEndian.PutUint64(header[:], uint64(r.off))
+		if r.full {
+			binary.LittleEndian.PutUint64(header[8:], 1)
+		}
+		r.file.WriteAt(header[:], 0)
+	}
+
+	return n, nil
+}
+
+// Bytes returns a copy of the contents, oldest first.
+func (r *RingBuffer) Bytes() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.full {
+		return append([]byte(nil), r.buf[:r.off]...)
+	}
+
+	out := make([]byte, 0, len(r.buf))
+	out = append(out, r.buf[r.off:]...)
+	return append(out, r.buf[:r.off]...)
+}
+
+// WriteTo writes the contents to w, oldest first.
+func (r *RingBuffer) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(r.Bytes())
+	return int64(n), err
+}
+
+// DumpOnSignal writes the contents to w whenever the process receives one
+// of sigs, e.g. syscall.SIGUSR2. The returned function stops it.
+func (r *RingBuffer) DumpOnSignal(w io.Writer, sigs ...os.Signal) (stop func()) {
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, sigs...)
+
+	go func() {
+		for {
+			select {
+			case <-signals:
+				r.WriteTo(w)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(signals)
+			close(done)
+		})
+	}
+}
+
+// Close closes the file of a ring buffer opened with OpenRingBuffer, and
+// leaves it in place.
+func (r *RingBuffer) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
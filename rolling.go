@@ -1,22 +1,70 @@
 package rolling
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
 	"os"
 	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+)
+
+const (
+	DefaultDateFormat = "20060102_15:04:05"
+	DefaultFileMode   = os.FileMode(0640)
+	// HivePartitionLayout is a PartitionLayout for Hive-style daily and
+	// hourly partitions.
+	HivePartitionLayout = "dt=2006-01-02/hour=15"
+	// DateFormatRFC3339Safe is RFC 3339 without the colons, which some
+	// filesystems and tools reject, as in "2024-06-01T130000+0800". The
+	// offset makes names unambiguous; with UTCFilenames they also sort in
+	// time order across time zones, as in "2024-06-01T050000Z".
+	DateFormatRFC3339Safe = "2006-01-02T150405Z0700"
+	// MicrosecondDateFormat is DefaultDateFormat with microseconds, for
+	// short rotations that may start several files within a second.
+	MicrosecondDateFormat = DefaultDateFormat + ".000000"
+)
 
-	"github.com/djherbis/times"
+var (
+	ErrDirectIOUnsupported  = errors.New("rolling: direct I/O is not supported on this platform")
+	ErrWatchUnsupported     = errors.New("rolling: watching for external rotation is not supported on this platform")
+	ErrFileUnsupported      = errors.New("rolling: the file descriptor is not available on this platform or with DirectIO or Mmap")
+	ErrDateFormatCollision  = errors.New("rolling: DateFormat gives several periods the same file name")
+	ErrDateFormatUnsortable = errors.New("rolling: DateFormat names do not sort in time order")
 )
 
 type RollingFileAppender struct {
-	state *state
-	mu    sync.RWMutex
-	file  *os.File
+	state   *state
+	file    atomic.Pointer[fileHandle]
+	watcher *watcher
+
+	// rotateMu serializes time based rotations.
+	rotateMu sync.Mutex
+	// strictMu is held shared by writes and exclusively by rotations when
+	// StrictRotation is set.
+	strictMu sync.RWMutex
+
+	backfillMu sync.Mutex
+	backfill   *fileHandle
+
+	// lastUse orders the appenders of a DirectoryManager by their last
+	// write.
+	lastUse atomic.Int64
+
+	stopDump func()
 }
 
 type Config struct {
@@ -25,236 +73,2474 @@ type Config struct {
 	FilenamePrefix string
 	FilenameSuffix string
 	TimeLocation   *time.Location
-	MaxFiles       uint32
-	DateFormat     string
+	// TimeZone names the location used when TimeLocation is nil, as in
+	// "Asia/Shanghai", for configurations read from files.
+	TimeZone string
+	// MaxFiles keeps the newest MaxFiles files. It is a shorthand for a
+	// Retention of KeepLastN(MaxFiles) and is ignored when Retention is set.
+	// With 1, only the active file is kept: the file rotated away from is
+	// removed once OnRotate, or Upload when set, is done with it.
+	MaxFiles uint32
+	// DisableBirthTime orders the files for pruning by the dates in their
+	// names, or by modification time for names without one, instead of by
+	// birth time, for filesystems where birth times are unavailable or
+	// costly. Without it, files without a birth time are never pruned. The
+	// rolling_minimal build tag, which leaves out the dependency on
+	// github.com/djherbis/times, implies it.
+	DisableBirthTime bool
+	// Retention decides which files are pruned, e.g.
+	// And(MaxAge(7*24*time.Hour), MaxTotalSize(5<<30)). The file about to
+	// be created at a rotation is taken into account, as an empty file.
+	Retention RetentionPolicy
+	// InternalLogger receives the appender's own events, such as
+	// rotations and prunes, and the errors it cannot return from a call.
+	// Without it nothing but the errors is reported, on stderr.
+	InternalLogger *slog.Logger
+	// DateFormat is a time.Format layout. It may also contain %G and %V,
+	// the ISO 8601 week-numbering year and week, as in "%G-W%V".
+	DateFormat string
+	// UTCFilenames renders the dates of file names in UTC. Rotations still
+	// happen at the boundaries of TimeLocation.
+	UTCFilenames bool
+	// ExtendDateFormat appends the missing fields to a DateFormat that is
+	// too coarse for the rotation, e.g. "2006010215" becomes
+	// "2006010215.04" for Minutely. Without it New returns
+	// ErrDateFormatCollision rather than append several periods to one
+	// file.
+	ExtendDateFormat bool
+	// DirectIO opens log files with O_DIRECT and writes them through an
+	// aligned buffer, keeping log data out of the page cache. Buffered
+	// data reaches the file in 64 KiB blocks and on rotation. Linux only.
+	DirectIO bool
+	// Mirror, when set, receives a copy of every write, e.g. a syslog or
+	// journald writer. Mirror errors are reported to stderr and do not
+	// fail the write.
+	Mirror io.Writer
+	// RingBuffer, when set, receives every write before the log file, so
+	// that the tail of the log survives the failure of its disk.
+	RingBuffer *RingBuffer
+	// DumpOnSignal makes the appender write a line of DumpState whenever
+	// the process receives SIGUSR1, to DumpWriter, or to the log itself
+	// when it is nil. It is ignored on Windows.
+	DumpOnSignal bool
+	DumpWriter   io.Writer
+	// IncludeHostname and Labels are rendered between the prefix and the
+	// date, as in "app-web01.env=prod.20240601_13:00:00.log", so that
+	// collected files remain attributable to their source. Labels are
+	// sorted by key.
+	IncludeHostname bool
+	Labels          map[string]string
+	// MaxFileSize, when positive, starts a new file within the same period
+	// once a write would take the current one over this many bytes. The
+	// files of a period are numbered "app-20240601.log", "app-20240601.1.log"
+	// and so on, and the numbering resumes from existing files on restart.
+	MaxFileSize int64
+	// MaxLinesPerFile, when positive, likewise starts the next sequence
+	// file once a write would take the current one over this many lines,
+	// for loaders that cap the records per file. Lines are counted by
+	// newlines; a write is never split.
+	MaxLinesPerFile int64
+	// SoftMaxFileSize and SoftMaxFiles, when positive, call OnThreshold
+	// once the active file grows past SoftMaxFileSize bytes, and after
+	// every rotation leaving more than SoftMaxFiles files, so that
+	// operators can be alerted before MaxFileSize or the retention cut in.
+	SoftMaxFileSize int64
+	SoftMaxFiles    int
+	OnThreshold     func(Threshold)
+	// PruneGlob and PruneRegexp select the files that belong to the
+	// appender by their whole name instead of by prefix and suffix, for
+	// directories shared with other files or legacy naming schemes. When
+	// both are set a file has to match both.
+	PruneGlob   string
+	PruneRegexp *regexp.Regexp
+	// PruneExclude lists glob patterns of files that are never pruned,
+	// e.g. "*-audit-*". Patterns containing a slash match the path relative
+	// to Directory, as in "dt=*/hour=00/*" with PartitionLayout or
+	// RecursivePrune; others match the base name of files at any depth.
+	// Protected files do not count towards the Retention.
+	PruneExclude []string
+	// BeforeDelete is called for every file pruning is about to remove,
+	// e.g. to ship it to cold storage first. The file is kept when it
+	// returns false or an error.
+	BeforeDelete func(file FileInfo) (delete bool, err error)
+	// OnRotate is called with the previous file once a rotation has closed
+	// it and every write to it has completed.
+	OnRotate func(file FileInfo)
+	// Upload ships every rotated file, e.g. to object storage, on a
+	// background goroutine. Failed uploads are retried with backoff, and
+	// the files waiting for upload are recorded in a file named after the
+	// prefix and suffix, as in "app-upload-queue.log", so that they are
+	// shipped after a restart and never pruned before. The context is
+	// canceled by Close.
+	Upload func(ctx context.Context, file FileInfo) error
+	// WritePidFile keeps a file named after the prefix, as in "app.pid",
+	// holding the PID of the process and, on a second line, the name of
+	// the active file. It is rewritten at every rotation and removed by
+	// Close, so that external agents can tell who owns the active file.
+	WritePidFile bool
+	// MaxBytesPerInterval, when positive, caps the bytes written in every
+	// BurstInterval, DefaultBurstInterval when zero, to protect the disk
+	// during log storms. Records over the budget are dropped, and a line
+	// summarizing them, as in "rolling: suppressed 1048576 bytes / 8192
+	// lines since 2024-06-01T13:00:00Z", is written when the interval ends
+	// or the appender is closed.
+	MaxBytesPerInterval int64
+	BurstInterval       time.Duration
+	// OpenFileFunc replaces os.OpenFile for creating and opening the log
+	// files, e.g. to apply SELinux labels or extended attributes. It is
+	// given the full path and must honor the flags.
+	OpenFileFunc func(name string, flag int, perm os.FileMode) (*os.File, error)
+	// Metadata stamps every rotated file with its period, the host name
+	// and AppVersion, for indexing that does not rely on file names.
+	Metadata   MetadataMode
+	AppVersion string
+	// TempFiles creates new files under a temporary name, renamed once
+	// they are ready, so that they never match the globs of collectors
+	// early.
+	TempFiles TempFileMode
+	// OrphanRecovery decides what New does with the temporary and partial
+	// files left behind by a crashed run, so that they neither linger nor
+	// throw off the retention.
+	OrphanRecovery OrphanPolicy
+	// Compress gzips every rotated file in the background, as in
+	// "app-20240601.log.gz". The appenders of a DirectoryManager share its
+	// compression workers.
+	Compress bool
+	// Retainers are asked before pruning removes a file, so that
+	// integrations shipping files elsewhere can hold on to the ones they
+	// have not shipped yet. The Upload queue is one of them.
+	Retainers []Retainer
+	// IndexFiles keeps the list of log files in memory, adding the files
+	// the appender creates and dropping those it removes, so that pruning
+	// reads the directory only every IndexRescan, DefaultIndexRescan when
+	// zero, to pick up files created or removed by others. PersistIndex
+	// saves the index to a file, as in "app-index.log", sparing the scan
+	// on startup.
+	IndexFiles   bool
+	IndexRescan  time.Duration
+	PersistIndex bool
+	// NoDelete never renames or removes a file, for filesystems where the
+	// process may create files but not delete them. Pruning appends the
+	// paths of the files to remove to a manifest, as in
+	// "app-deletions.log", for a privileged cleaner; they count towards
+	// the retention no more until they are gone. Options that rename
+	// files, such as Compress and TempFiles, are rejected.
+	NoDelete bool
+	// OnDiskFull decides what a write does when the disk is full, instead
+	// of failing with ENOSPC.
+	OnDiskFull DiskFullPolicy
+	// FallbackWriter receives the records DiskFullFallback cannot write,
+	// e.g. os.Stderr.
+	FallbackWriter io.Writer
+	// RecursivePrune makes listing and pruning descend into subdirectories
+	// of Directory, e.g. dated ones, and removes the directories pruning
+	// leaves empty.
+	RecursivePrune bool
+	// AnchorToFirstWrite starts the rotation window of a file at its first
+	// write instead of aligning it to the clock, so that every file of a
+	// low-traffic service covers a full window of activity.
+	AnchorToFirstWrite bool
+	// NameByPeriodStart names files after the start of the period they
+	// cover, e.g. "app-2024060113.log" for 13:00-14:00, instead of after
+	// the moment they were created, so that names are predictable. The
+	// default DateFormat is then as precise as the rotation.
+	NameByPeriodStart bool
+	// ReusePeriodFile makes New append to the newest existing file of the
+	// current period, instead of creating a second one named after the
+	// restart time.
+	ReusePeriodFile bool
+	// PartitionLayout, a DateFormat-style layout such as
+	// HivePartitionLayout, names a subdirectory for every period, e.g.
+	// "dt=2024-06-01/hour=13/app.log", for data-lake partitions. The
+	// date is then left out of the file names, which need a
+	// FilenamePrefix or FilenameSuffix, and RecursivePrune and
+	// CreateDirectory are implied.
+	PartitionLayout string
+	// FileMode is the permission of the log files, DefaultFileMode when
+	// zero. It is applied regardless of the umask; set 0666 for the
+	// permissions of earlier versions.
+	FileMode os.FileMode
+	// WatchExternalRotation reopens the file as soon as another program
+	// such as logrotate renames or removes it. Linux only, using inotify.
+	WatchExternalRotation bool
+	// CrashOutput additionally sends the output of fatal errors and
+	// unrecovered panics to the log, see debug.SetCrashOutput. Go 1.23+.
+	CrashOutput CrashOutput
+	// Clock replaces the system clock, e.g. with rollingtest.Clock.
+	Clock Clock
+	// StrictRotation makes time based rotations wait for in-flight writes,
+	// so that every write that started before a boundary ends up in the
+	// file of that period and every later write in the next one. Writes
+	// then briefly stall at each boundary.
+	StrictRotation bool
+	// RecordLatency measures every write and rotation for the
+	// WriteLatency and RotationLatency of Stats.
+	RecordLatency bool
+	// CoalesceWrites joins the records of writers that arrive while
+	// another write is in progress into a single write call, saving
+	// system calls under contention at the cost of copying those records.
+	CoalesceWrites bool
+	// Mmap, an experimental mode for very high write rates, appends
+	// through a shared memory mapping that grows the file 4 MiB at a time
+	// and schedules each full chunk for writeback. The file has zeros at
+	// its end until it is closed, which New trims after a crash. Platforms
+	// without mmap fall back to plain writes. It cannot be combined with
+	// DirectIO.
+	Mmap bool
+	// SyncDirectory fsyncs the directory after files are created in it or
+	// removed from it, so that the names survive a power loss, as audit
+	// logs may require.
+	SyncDirectory bool
+	// CreateDirectory creates Directory, and subdirectories named by the
+	// prefix, when a file is opened in a directory that does not exist,
+	// e.g. after a volume was remounted. A write failing because the
+	// directory of the active file is gone recreates it and goes to a new
+	// file there. Where writes to the removed file still succeed, as on
+	// Linux, that file keeps receiving them until the next rotation or
+	// reopen.
+	CreateDirectory bool
+	// AuditMode makes the appender provably non-destructive, for
+	// regulatory logs: it never deletes files, so the Retention, the
+	// DirectoryManager and DiskFullEmergencyPrune leave them to an external
+	// process, every write is
+	// synced to disk before it returns, and the directory is synced as with
+	// SyncDirectory. It cannot be combined with DirectIO or Mmap, which
+	// rewrite or truncate the end of the file, nor, as with NoDelete, with
+	// the options that rename or remove files, such as Compress, TempFiles
+	// and OrphanRecovery.
+	AuditMode bool
+	// RotationMarker, when set, is a line written at the end of the old
+	// file and at the start of the new one on every rotation, so that the
+	// files can be stitched together. It is formatted with the name of the
+	// new file and the RFC 3339 time, as in "--- rotated to %s at %s ---".
+	// Writes in flight during the rotation may still follow it in the old
+	// file unless StrictRotation is set.
+	RotationMarker string
+	// Header, when set, returns the bytes written at the start of every new
+	// file, such as a CSV header or a record describing the process. Files
+	// that are reopened with content, as after a restart within the same
+	// period, are not given it again.
+	Header func(file FileInfo) []byte
+	// SkipOpenFiles keeps pruning from removing files that another process,
+	// such as a log shipper in the middle of an upload, has open. They are
+	// removed by a later pass once they are closed. Linux only, by scanning
+	// /proc; elsewhere it has no effect.
+	SkipOpenFiles bool
+}
+
+type Clock interface {
+	Now() time.Time
 }
 
 func New(config Config) (*RollingFileAppender, error) {
+	return newAppender(config, nil)
+}
+
+// newAppender is New for an appender joining manager, if not nil.
+func newAppender(config Config, manager *DirectoryManager) (*RollingFileAppender, error) {
 	state, err := newState(config)
 	if err != nil {
 		return nil, err
 	}
+	state.manager = manager
+
+	if err := state.claim(); err != nil {
+		return nil, err
+	}
+
+	state.recoverOrphans()
 
 	now := state.getNow()
-	file, err := state.createFile(now)
+	date, seq := now, state.lastSequence(now)
+	if state.reuse {
+		if d, n, ok := state.existingPeriodFile(now); ok {
+			date, seq = d, n
+		}
+	}
+
+	file, err := state.createFile(date, seq)
 	if err != nil {
+		state.unclaim()
 		return nil, err
 	}
 
 	a := &RollingFileAppender{
 		state: state,
-		file:  file,
+	}
+	a.file.Store(file)
+
+	if config.WatchExternalRotation {
+		if a.watcher, err = newWatcher(a); err != nil {
+			file.release()
+			state.unclaim()
+			return nil, err
+		}
+	}
+
+	if err := a.setupCrashOutput(file); err != nil {
+		if a.watcher != nil {
+			a.watcher.close()
+		}
+		file.release()
+		state.unclaim()
+		return nil, err
+	}
+
+	if state.uploader != nil {
+		state.uploader.start()
+	}
+	if state.pidFile {
+		state.writePidFile(file.name)
+	}
+	if config.DumpOnSignal {
+		a.stopDump = a.dumpOnSignal(config.DumpWriter)
+	}
+	if state.burst != nil {
+		state.burst.emit = a.emitBurstSummary
 	}
 
 	return a, nil
 }
 
-func (r *RollingFileAppender) refreshFile(now time.Time) {
-	if r.state.maxFiles > 0 {
-		r.state.prune_old_logs()
+// reopen replaces h, the active file, with a new file under the same name
+// after it was moved or removed by another program.
+func (r *RollingFileAppender) reopen(h *fileHandle) {
+	newFile, err := r.state.createFile(h.date, h.seq)
+	if err != nil {
+		r.state.logError("failed to reopen the log file", err)
+		return
 	}
 
-	newFile, err := r.state.createFile(now)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
+	if !r.file.CompareAndSwap(h, newFile) {
+		newFile.release()
 		return
 	}
+	h.release()
+	r.activated(newFile)
+	r.state.logEvent("reopened the log file", "file", newFile.name)
+}
 
-	r.mu.Lock()
-	defer r.mu.Unlock()
+// activated is called after h became the active file.
+func (r *RollingFileAppender) activated(h *fileHandle) {
+	if r.watcher != nil {
+		r.watcher.watch(h)
+	}
 
-	if r.file != nil {
-		if err := r.file.Close(); err != nil {
-			fmt.Fprintln(os.Stderr, err.Error())
+	if r.state.crashOutput == CrashOutputLog {
+		if err := setCrashOutput(h.file); err != nil {
+			r.state.logError("failed to set the crash output", err)
 		}
 	}
+}
 
-	r.file = newFile
+func (r *RollingFileAppender) refreshFile(now time.Time) error {
+	return r.openFile(now, r.state.lastSequence(now), nil)
 }
 
-func (r *RollingFileAppender) Write(p []byte) (n int, err error) {
+// openFile replaces the active file with the file for date and seq. When
+// current is not nil the replacement only happens if current is still the
+// active file.
+func (r *RollingFileAppender) openFile(date time.Time, seq int, current *fileHandle) error {
+	if r.state.recordLatency {
+		defer r.state.rotationLatency.since(time.Now())
+	}
+
+	if r.state.retention != nil {
+		// Make room for the file that is about to be created, but leave
+		// the active file alone until it has been rotated away from.
+		var active string
+		if h := r.file.Load(); h != nil {
+			active = h.name
+		}
+		if _, err := r.state.prune_old_logs(true, active); err != nil {
+			r.state.logError("failed to prune", err)
+		}
+	}
+
+	newFile, err := r.state.createFile(date, seq)
+	if err != nil {
+		return err
+	}
+
+	var marker []byte
+	if len(r.state.rotationMarker) > 0 {
+		marker = []byte(fmt.Sprintf(r.state.rotationMarker, newFile.name, r.state.getNow().Format(time.RFC3339)) + "\n")
+		if _, err := newFile.Write(marker); err != nil {
+			r.state.logError("failed to write the rotation marker", err)
+		}
+	}
+
+	for {
+		old := r.file.Load()
+		if old == nil {
+			newFile.release()
+			return os.ErrClosed
+		}
+
+		if current != nil && old != current {
+			newFile.release()
+			return nil
+		}
+
+		if r.file.CompareAndSwap(old, newFile) {
+			if marker != nil && !old.parked {
+				if _, err := old.Write(marker); err != nil {
+					r.state.logError("failed to write the rotation marker", err)
+				}
+			}
+			old.rotated.Store(true)
+			old.release()
+			r.activated(newFile)
+			r.state.logEvent("rotated the log file", "file", newFile.name, "previous", old.name)
+			if r.state.pidFile {
+				r.state.writePidFile(newFile.name)
+			}
+
+			if r.state.manager != nil {
+				if _, err := r.state.manager.Prune(); err != nil {
+					r.state.logError("failed to prune", err)
+				}
+			}
+			return nil
+		}
+	}
+}
+
+// Rotate closes the current file and opens a new one, regardless of the
+// rotation schedule.
+func (r *RollingFileAppender) Rotate() error {
+	if r.state.strict {
+		r.strictMu.Lock()
+		defer r.strictMu.Unlock()
+	}
+
+	r.rotateMu.Lock()
+	defer r.rotateMu.Unlock()
+
+	now := r.state.getNow()
+	if err := r.refreshFile(now); err != nil {
+		return err
+	}
+
+	// Restart the window, which matters for rotations measured from the
+	// creation of the file.
+	if r.state.rotates {
+		next := r.state.nextBoundary(now)
+		if r.state.anchored {
+			next = pendingAnchor
+		}
+		atomic.StoreInt64(&r.state.nextDate, next)
+	}
+
+	return nil
+}
+
+// SetLocation changes TimeLocation, e.g. after the system time zone has
+// changed, and moves the next rotation to the next boundary in loc.
+// Existing files keep their names; if the active file's period in loc
+// has already passed, the next write rotates.
+func (r *RollingFileAppender) SetLocation(loc *time.Location) {
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	r.rotateMu.Lock()
+	defer r.rotateMu.Unlock()
+
+	r.state.location.Store(loc)
+	if !r.state.rotates || r.state.anchored {
+		// Anchored windows are measured from the first write.
+		return
+	}
+
 	now := r.state.getNow()
-	if current := r.state.shouldRollover(now); current != nil {
-		if r.state.AdvanceDate(now, *current) {
-			r.refreshFile(now)
+	next := r.state.nextBoundary(now)
+	if rotation, ok := r.state.rotation.(PeriodicRotation); ok && r.state.rotation != Never {
+		if h := r.file.Load(); h != nil && !rotation.Round(h.date.In(loc)).Equal(rotation.Round(now)) {
+			next = now.UnixNano()
 		}
 	}
+	atomic.StoreInt64(&r.state.nextDate, next)
+}
+
+// Prune removes the log files the retention does not keep and returns
+// their names.
+func (r *RollingFileAppender) Prune() ([]string, error) {
+	return r.state.prune_old_logs(false, "")
+}
+
+// Files returns the names of the log files in the directory, oldest first.
+func (r *RollingFileAppender) Files() ([]string, error) {
+	files, err := r.state.listLogs()
+	if err != nil {
+		return nil, err
+	}
 
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, file.Name)
+	}
 
-	return r.file.Write(p)
+	return names, nil
 }
 
-func createFile(directory, filename string) (*os.File, error) {
-	name := path.Join(directory, filename)
+// ListFiles returns the names of the log files matching the config, oldest
+// first, without opening an appender.
+func ListFiles(config Config) ([]string, error) {
+	state, err := newState(config)
+	if err != nil {
+		return nil, err
+	}
 
-	return os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	return (&RollingFileAppender{state: state}).Files()
 }
 
-type state struct {
-	logDirectory      string
-	logFilenamePrefix string
-	logFilenameSuffix string
-	maxFiles          uint32
-	rotation          Rotation
-	dateFormat        string
-	timeLocation      *time.Location
+// PruneFiles applies the retention of the config to its directory without
+// opening an appender, and returns the names of the removed files.
+func PruneFiles(config Config) ([]string, error) {
+	state, err := newState(config)
+	if err != nil {
+		return nil, err
+	}
 
-	nextDate int64
+	return state.prune_old_logs(false, "")
 }
 
-func newState(config Config) (*state, error) {
-	s := &state{
-		logDirectory:      config.Directory,
-		logFilenamePrefix: config.FilenamePrefix,
-		logFilenameSuffix: config.FilenameSuffix,
-		dateFormat:        config.DateFormat,
-		timeLocation:      config.TimeLocation,
-		maxFiles:          config.MaxFiles,
-		rotation:          config.Rotation,
+type Stats struct {
+	// PruneFailures counts the failed attempts to remove a log file.
+	PruneFailures uint64
+	// PendingRemovals is the number of files that pruning failed to remove
+	// and retries on its next pass.
+	PendingRemovals int
+	// FileSize is the number of bytes in the active file, counting those
+	// written since it was opened on top of its size at the time.
+	FileSize int64
+	// WriteLatency and RotationLatency are recorded with RecordLatency.
+	// Write latency includes waiting for a rotation.
+	WriteLatency    Latency
+	RotationLatency Latency
+	// DiskFullDrops counts the records dropped by DiskFullDrop.
+	DiskFullDrops uint64
+}
+
+func (r *RollingFileAppender) Stats() Stats {
+	r.state.pruneMu.Lock()
+	pending := len(r.state.pendingRemovals)
+	r.state.pruneMu.Unlock()
+
+	stats := Stats{
+		PruneFailures:   r.state.pruneFailures.Load(),
+		PendingRemovals: pending,
+		DiskFullDrops:   r.state.diskFullDrops.Load(),
 	}
 
-	if s.timeLocation == nil {
-		s.timeLocation = time.UTC
+	if h := r.file.Load(); h != nil {
+		stats.FileSize = h.size.Load()
 	}
 
-	if len(s.dateFormat) == 0 {
-		s.dateFormat = "20060102_15:04:05"
+	if r.state.recordLatency {
+		stats.WriteLatency = r.state.writeLatency.latency()
+		stats.RotationLatency = r.state.rotationLatency.latency()
 	}
 
-	if len(s.logDirectory) == 0 {
-		pwd, err := os.Getwd()
-		if err != nil {
-			return nil, err
-		}
+	return stats
+}
 
-		s.logDirectory = pwd
+// Generation identifies the active file. It changes whenever the file is
+// swapped, so holders of a descriptor from File can tell when to fetch a
+// new one. It returns 0 once the appender is closed.
+func (r *RollingFileAppender) Generation() uint64 {
+	h := r.file.Load()
+	if h == nil {
+		return 0
 	}
 
-	if nextDate := s.rotation.NextDate(s.getNow()); nextDate != nil {
-		s.nextDate = nextDate.Unix()
+	return h.generation
+}
+
+// File returns a duplicate of the descriptor of the active file along with
+// its generation, e.g. to redirect the output of a child process into the
+// log. The caller closes it. Writes through it bypass MaxFileSize and keep
+// going to the same file after a rotation.
+func (r *RollingFileAppender) File() (*os.File, uint64, error) {
+	if r.state.directIO || r.state.mmap {
+		return nil, 0, ErrFileUnsupported
 	}
 
-	return s, nil
+	h := r.acquireFile()
+	if h == nil {
+		return nil, 0, os.ErrClosed
+	}
+	defer h.release()
+
+	file, err := dupFile(h.file)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return file, h.generation, nil
 }
 
-func (s *state) getNow() time.Time {
-	return time.Now().In(s.timeLocation)
+// CurrentFilename returns the name of the active file relative to the
+// directory, or "" once the appender is closed.
+func (r *RollingFileAppender) CurrentFilename() string {
+	h := r.file.Load()
+	if h == nil {
+		return ""
+	}
+
+	return h.name
+}
+
+// Directory returns the directory the log files are written to.
+func (r *RollingFileAppender) Directory() string {
+	return r.state.logDirectory
 }
 
-func (s *state) prune_old_logs() {
-	if s.maxFiles == 0 {
+func (r *RollingFileAppender) rollover() {
+	if !r.state.rotates {
 		return
 	}
 
-	entries, err := os.ReadDir(s.logDirectory)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "failed to read dir", err.Error())
+	current, ok := r.state.shouldRollover(r.state.unixNano())
+	if !ok {
 		return
 	}
 
-	type LogEntry struct {
-		FullPath string
-		Ctime    time.Time
+	if current == pendingAnchor {
+		// First write to the file: the window starts now.
+		atomic.CompareAndSwapInt64(&r.state.nextDate, current, r.state.nextBoundary(r.state.getNow()))
+		return
 	}
 
-	var files []*LogEntry
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
+	// Writers crossing the boundary together wait for the one that swaps
+	// the file instead of writing to the old file in the meantime.
+	r.rotateMu.Lock()
+	defer r.rotateMu.Unlock()
 
-		filename := entry.Name()
-		if len(s.logFilenamePrefix) > 0 && !strings.HasPrefix(filename, s.logFilenamePrefix) {
-			continue
-		}
+	if atomic.LoadInt64(&r.state.nextDate) != current {
+		return
+	}
 
-		if len(s.logFilenameSuffix) > 0 && !strings.HasSuffix(filename, s.logFilenameSuffix) {
-			continue
-		}
+	now := r.state.getNow()
+	if err := r.refreshFile(now); err != nil {
+		r.state.logError("failed to rotate", err)
+	}
+	r.state.AdvanceDate(now, current)
+}
 
-		fullPath := path.Join(s.logDirectory, filename)
-		t, err := times.Stat(fullPath)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "failed to read file", err)
-			continue
-		}
+// beginWrite rotates the file when a boundary has passed. It has to be
+// paired with endWrite.
+func (r *RollingFileAppender) beginWrite() {
+	if !r.state.strict {
+		r.rollover()
+		return
+	}
 
-		if !t.HasBirthTime() {
-			continue
+	r.strictMu.RLock()
+	for r.state.rotates {
+		if _, ok := r.state.shouldRollover(r.state.unixNano()); !ok {
+			return
 		}
 
-		files = append(files, &LogEntry{FullPath: fullPath, Ctime: t.BirthTime()})
+		// Rotate once every write holding the old file has finished.
+		r.strictMu.RUnlock()
+		r.strictMu.Lock()
+		r.rollover()
+		r.strictMu.Unlock()
+		r.strictMu.RLock()
 	}
+}
 
-	if len(files) < int(s.maxFiles) {
-		return
+func (r *RollingFileAppender) endWrite() {
+	if r.state.strict {
+		r.strictMu.RUnlock()
 	}
+}
 
-	sort.Slice(files, func(i, j int) bool {
-		return files[i].Ctime.Before(files[j].Ctime)
-	})
+func (r *RollingFileAppender) Write(p []byte) (n int, err error) {
+	if r.state.recordLatency {
+		defer r.state.writeLatency.since(time.Now())
+	}
 
-	for i := 0; i < len(files)-int(s.maxFiles)+1; i++ {
-		err := os.Remove(files[i].FullPath)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "failed to remove the log entry", err)
+	r.beginWrite()
+	defer r.endWrite()
+
+	if !r.limitBurst(p) {
+		return len(p), nil
+	}
+
+	h := r.acquireFileFor(len(p), r.state.countLines(p))
+	if h == nil {
+		return 0, os.ErrClosed
+	}
+	defer h.release()
+
+	n, err = r.writeFile(h, p)
+	r.mirror(p)
+
+	return n, err
+}
+
+func (r *RollingFileAppender) writeFile(h *fileHandle, p []byte) (int, error) {
+	if r.state.ring != nil {
+		r.state.ring.Write(p)
+	}
+
+	n, err := r.writeOnce(h, p)
+	if err != nil && r.state.onDiskFull != DiskFullError && isDiskFull(err) {
+		n, err = r.diskFull(h, p, n, err)
+	}
+	h.wrote(n)
+	r.state.checkSoftSize(h)
+
+	if err != nil && r.state.createDir && r.state.dirRemoved(h) {
+		n, err = r.writeRecreated(h, p, n, err)
+	}
+
+	return n, err
+}
+
+// dirRemoved reports whether the directory of the file of h is gone.
+func (s *state) dirRemoved(h *fileHandle) bool {
+	_, err := os.Stat(path.Dir(path.Join(s.logDirectory, h.name)))
+	return errors.Is(err, fs.ErrNotExist)
+}
+
+// writeRecreated writes the rest of p, after the first n bytes failed with
+// err, to a new file in the recreated directory of the active file h, with
+// CreateDirectory.
+func (r *RollingFileAppender) writeRecreated(h *fileHandle, p []byte, n int, err error) (int, error) {
+	if r.file.Load() != h {
+		return n, err
+	}
+
+	r.reopen(h)
+	c := r.acquireFile()
+	if c == nil {
+		return n, err
+	}
+	defer c.release()
+	if c == h {
+		return n, err
+	}
+
+	m, err := r.writeOnce(c, p[n:])
+	c.wrote(m)
+
+	return n + m, err
+}
+
+func (r *RollingFileAppender) writeOnce(h *fileHandle, p []byte) (int, error) {
+	if r.state.audit {
+		n, err := h.Write(p)
+		if err == nil {
+			err = h.Sync()
 		}
+		return n, err
+	}
+
+	if r.state.coalesce {
+		return h.coalescedWrite(p)
+	}
+
+	return h.Write(p)
+}
+
+func (r *RollingFileAppender) mirror(p []byte) {
+	if r.state.mirror == nil {
+		return
+	}
+
+	if _, err := r.state.mirror.Write(p); err != nil {
+		r.state.logError("failed to mirror the log entry", err)
 	}
 }
 
-func (s *state) createFile(date time.Time) (*os.File, error) {
-	var filename = s.joinDate(date)
+var batchPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// maxPooledBatch caps the buffers returned to batchPool, so that one huge
+// batch does not stay allocated for the life of the pool.
+const maxPooledBatch = 64 << 10
 
-	return createFile(s.logDirectory, filename)
+func putBatch(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBatch {
+		batchPool.Put(buf)
+	}
 }
 
-func (s *state) shouldRollover(date time.Time) *time.Time {
-	var nextDate = atomic.LoadInt64(&s.nextDate)
-	if nextDate == 0 {
-		return nil
+// WriteBatch writes several records to the same file with a single
+// write call. It returns the total number of bytes written.
+func (r *RollingFileAppender) WriteBatch(records [][]byte) (int, error) {
+	if r.state.recordLatency {
+		defer r.state.writeLatency.since(time.Now())
 	}
 
-	nextT := time.Unix(nextDate, 0).In(s.timeLocation)
-	if date.Unix() >= nextDate {
-		return &nextT
+	r.beginWrite()
+	defer r.endWrite()
+
+	buf := batchPool.Get().(*bytes.Buffer)
+	defer putBatch(buf)
+
+	buf.Reset()
+	for _, record := range records {
+		buf.Write(record)
 	}
 
-	return nil
+	if !r.limitBurst(buf.Bytes()) {
+		return buf.Len(), nil
+	}
+
+	h := r.acquireFileFor(buf.Len(), r.state.countLines(buf.Bytes()))
+	if h == nil {
+		return 0, os.ErrClosed
+	}
+	defer h.release()
+
+	n, err := r.writeFile(h, buf.Bytes())
+	for _, record := range records {
+		r.mirror(record)
+	}
+
+	return n, err
 }
 
-func (s *state) AdvanceDate(now, current time.Time) bool {
-	var nextDate = s.rotation.NextDate(now)
-	return atomic.CompareAndSwapInt64(&s.nextDate, current.Unix(), nextDate.Unix())
+// WriteUrgent writes p and syncs the file, so that p is on disk, along with
+// any data buffered for direct I/O, when it returns.
+func (r *RollingFileAppender) WriteUrgent(p []byte) (int, error) {
+	n, err := r.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	return n, r.Sync()
 }
 
-func (s *state) joinDate(date time.Time) string {
-	dateStr := date.Format(s.dateFormat)
+// Sync writes out buffered data, such as the tail of a direct I/O buffer,
+// and commits the current file to stable storage.
+func (r *RollingFileAppender) Sync() error {
+	h := r.acquireFile()
+	if h == nil {
+		return os.ErrClosed
+	}
+	defer h.release()
 
-	switch s.rotation {
-	case Never:
-		if len(s.logFilenamePrefix) > 0 && len(s.logFilenameSuffix) > 0 {
-			return s.logFilenamePrefix + s.logFilenameSuffix
-		}
-		if len(s.logFilenamePrefix) > 0 {
-			return s.logFilenamePrefix
-		}
-		if len(s.logFilenameSuffix) > 0 {
-			return s.logFilenameSuffix
+	return h.Sync()
+}
+
+// SyncAndStat syncs the current file and returns its path and size, so
+// that tests can read back exactly what has been written.
+func (r *RollingFileAppender) SyncAndStat() (string, int64, error) {
+	h := r.acquireFile()
+	if h == nil {
+		return "", 0, os.ErrClosed
+	}
+	defer h.release()
+
+	if err := h.Sync(); err != nil {
+		return "", 0, err
+	}
+
+	// A memory mapped file is longer than its data until it is closed.
+	size := h.size.Load()
+	if !r.state.mmap {
+		info, err := h.file.Stat()
+		if err != nil {
+			return "", 0, err
 		}
+		size = info.Size()
+	}
 
-	default:
-		if len(s.logFilenamePrefix) > 0 && len(s.logFilenameSuffix) > 0 {
-			return s.logFilenamePrefix + dateStr + s.logFilenameSuffix
+	return path.Join(r.state.logDirectory, h.name), size, nil
+}
+
+// Close closes the current file. Writes after Close fail with
+// os.ErrClosed.
+func (r *RollingFileAppender) Close() error {
+	if r.state.burst != nil {
+		if summary := r.state.burst.flush(); summary != nil {
+			r.emitBurstSummary(summary)
 		}
-		if len(s.logFilenamePrefix) > 0 {
-			return s.logFilenamePrefix + dateStr
+	}
+
+	h := r.file.Swap(nil)
+	if h == nil {
+		return os.ErrClosed
+	}
+
+	if r.watcher != nil {
+		r.watcher.close()
+	}
+	if r.stopDump != nil {
+		r.stopDump()
+	}
+
+	if r.state.manager != nil {
+		r.state.manager.remove(r)
+	}
+	r.state.unclaim()
+	r.closeBackfill()
+	if r.state.uploader != nil {
+		r.state.uploader.stop()
+	}
+	if r.state.compressor != nil && r.state.manager == nil {
+		defer r.state.compressor.close()
+	}
+	if r.state.pidFile {
+		r.state.removePidFile()
+	}
+
+	if h.parked {
+		return nil
+	}
+
+	// With writes still in flight the last of them closes the file, and
+	// any close error goes to stderr as it does for rotations.
+	h.retired.Store(true)
+	if !h.refs.CompareAndSwap(1, 0) {
+		h.release()
+		return nil
+	}
+
+	err := h.w.Close()
+	h.commitTemp()
+	r.state.closed(h)
+	return err
+}
+
+// acquireFile returns the active file with a reference held, so that a
+// concurrent rotation closes it only after the caller releases it. It
+// returns nil once the appender is closed.
+func (r *RollingFileAppender) acquireFile() *fileHandle {
+	for {
+		h := r.file.Load()
+		if h != nil && h.parked {
+			if !r.unpark(h) {
+				return nil
+			}
+			continue
 		}
-		if len(s.logFilenameSuffix) > 0 {
-			return dateStr + s.logFilenameSuffix
+
+		if h == nil || h.acquire() {
+			return h
 		}
 	}
+}
 
-	return dateStr
+// park closes the active file to free its descriptor, leaving a parked
+// handle that the next acquireFile reopens.
+func (r *RollingFileAppender) park() bool {
+	h := r.file.Load()
+	if h == nil || h.parked {
+		return false
+	}
+
+	p := &fileHandle{
+		date:       h.date,
+		seq:        h.seq,
+		name:       h.name,
+		onRotate:   h.onRotate,
+		generation: h.generation,
+		parked:     true,
+	}
+	p.refs.Store(1)
+	p.size.Store(h.size.Load())
+	p.lines.Store(h.lines.Load())
+
+	if !r.file.CompareAndSwap(h, p) {
+		return false
+	}
+	h.release()
+
+	return true
+}
+
+// unpark reopens the file of the parked handle h. It reports false when
+// the file cannot be opened.
+func (r *RollingFileAppender) unpark(h *fileHandle) bool {
+	newFile, err := r.state.createFile(h.date, h.seq)
+	if err != nil {
+		r.state.logError("failed to reopen the parked log file", err)
+		return false
+	}
+
+	if !r.file.CompareAndSwap(h, newFile) {
+		newFile.release()
+		return true
+	}
+	h.release()
+	r.activated(newFile)
+
+	if r.state.manager != nil {
+		r.state.manager.opened(r)
+	}
+
+	return true
+}
+
+// acquireFileFor is acquireFile for a write of n bytes and lines lines. It
+// first moves on to the next sequence file when the write would take the
+// active file over MaxFileSize or MaxLinesPerFile.
+func (r *RollingFileAppender) acquireFileFor(n int, lines int64) *fileHandle {
+	if r.state.manager != nil {
+		r.lastUse.Store(r.state.manager.uses.Add(1))
+	}
+
+	h := r.acquireFile()
+	if h == nil || !r.state.sequenced() {
+		return h
+	}
+
+	if r.state.full(h, n, lines) {
+		if h.rotating.CompareAndSwap(false, true) {
+			if err := r.openFile(h.date, h.seq+1, h); err != nil {
+				// The next write gets to try again.
+				h.rotating.Store(false)
+				r.state.logError("failed to rotate", err)
+			}
+		}
+		h.release()
+
+		if h = r.acquireFile(); h == nil {
+			return nil
+		}
+	}
+
+	h.lines.Add(lines)
+
+	return h
+}
+
+// sequenced reports whether files are split into sequence files within a
+// period.
+func (s *state) sequenced() bool {
+	return s.maxFileSize > 0 || s.maxLines > 0
+}
+
+func (s *state) full(h *fileHandle, n int, lines int64) bool {
+	if size := h.size.Load(); s.maxFileSize > 0 && size > 0 && size+int64(n) > s.maxFileSize {
+		return true
+	}
+
+	current := h.lines.Load()
+	return s.maxLines > 0 && current > 0 && current+lines > s.maxLines
+}
+
+func (s *state) countLines(p []byte) int64 {
+	if s.maxLines <= 0 {
+		return 0
+	}
+
+	return int64(bytes.Count(p, newline))
+}
+
+var newline = []byte{'\n'}
+
+// countFileLines counts the newlines in the first size bytes of a file.
+func countFileLines(name string, size int64) (int64, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	buf := make([]byte, 64*1024)
+	r := io.LimitReader(file, size)
+
+	var lines int64
+	for {
+		n, err := r.Read(buf)
+		lines += int64(bytes.Count(buf[:n], newline))
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (s *state) openLogFile(filename string, flag int) (*os.File, error) {
+	name := path.Join(s.logDirectory, filename)
+
+	if flag&os.O_RDWR == 0 {
+		flag |= os.O_WRONLY
+	}
+
+	openFile := os.OpenFile
+	if s.openFileFunc != nil {
+		openFile = s.openFileFunc
+	}
+
+	file, err := openFile(name, os.O_APPEND|os.O_CREATE|flag, s.fileMode)
+	if err != nil {
+		return nil, err
+	}
+
+	// OpenFile applies the umask, which differs between services and
+	// containers.
+	if err := file.Chmod(s.fileMode); err != nil {
+		s.logError("failed to set file mode", err)
+	}
+
+	return file, nil
+}
+
+// fileHandle is a reference counted log file. The appender owns one
+// reference to the active handle and every in-flight write holds another;
+// the file is closed when the last reference is released.
+type fileHandle struct {
+	file *os.File
+	w    io.WriteCloser
+	refs atomic.Int64
+	date time.Time
+	seq  int
+	name string
+
+	rotating atomic.Bool
+	rotated  atomic.Bool
+	onRotate func(name string)
+	// state reports errors closing the file.
+	state *state
+	// temp is set while the file has its temporary name, and retired once
+	// it is closed for good without a rotation.
+	temp    atomic.Bool
+	retired atomic.Bool
+	// overSoftSize is set once the file has gone over SoftMaxFileSize.
+	overSoftSize atomic.Bool
+
+	generation uint64
+	// size counts the bytes of the file, including those still buffered
+	// for direct I/O.
+	size atomic.Int64
+	// lines counts the newlines of the file for MaxLinesPerFile.
+	lines atomic.Int64
+
+	combiner combiner
+
+	// parked handles stand for a file closed by DirectoryManager to stay
+	// within MaxOpenFiles. They have no file.
+	parked bool
+}
+
+func newFileHandle(file *os.File, direct, mmap bool, date time.Time, seq int) (*fileHandle, error) {
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	h := &fileHandle{file: file, w: file, date: date, seq: seq}
+	h.refs.Store(1)
+
+	// Appending to an existing file, e.g. after a restart.
+	size := info.Size()
+
+	switch {
+	case direct:
+		w, err := newAlignedWriter(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		h.w = w
+
+	case mmap:
+		if size, err = mmapDataSize(file, size); err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		w, err := newMmapWriter(file, size)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		h.w = w
+	}
+
+	h.size.Store(size)
+
+	return h, nil
+}
+
+func (h *fileHandle) Write(p []byte) (int, error) {
+	n, err := h.w.Write(p)
+	h.size.Add(int64(n))
+	return n, err
+}
+
+func (h *fileHandle) Sync() error {
+	if w, ok := h.w.(interface{ Flush() error }); ok {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return h.file.Sync()
+}
+
+func (h *fileHandle) acquire() bool {
+	for {
+		n := h.refs.Load()
+		if n <= 0 {
+			return false
+		}
+		if h.refs.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+func (h *fileHandle) release() {
+	if h.refs.Add(-1) == 0 {
+		// The file of a parked handle was closed when it was parked.
+		if !h.parked {
+			if err := h.w.Close(); err != nil {
+				h.state.logError("failed to close the log file", err)
+			}
+			if h.rotated.Load() || h.retired.Load() {
+				h.commitTemp()
+			}
+			if h.state != nil {
+				h.state.closed(h)
+			}
+		}
+
+		if h.rotated.Load() && h.onRotate != nil {
+			h.onRotate(h.name)
+		}
+	}
+}
+
+type state struct {
+	logDirectory      string
+	logFilenamePrefix string
+	logFilenameSuffix string
+	retention         RetentionPolicy
+	logger            *slog.Logger
+	rotation          Rotation
+	dateFormat        string
+	// location is TimeLocation, which SetLocation changes.
+	location       atomic.Pointer[time.Location]
+	utcNames       bool
+	noDelete       bool
+	noBirthTime    bool
+	directIO       bool
+	rotates        bool
+	mirror         io.Writer
+	ring           *RingBuffer
+	namePrefix     string
+	maxFileSize    int64
+	maxLines       int64
+	pruneGlob      string
+	pruneRegexp    *regexp.Regexp
+	pruneExclude   []string
+	beforeDelete   func(FileInfo) (bool, error)
+	onRotate       func(FileInfo)
+	uploader       *uploader
+	retainers      []Retainer
+	pidFile        bool
+	burst          *burstLimiter
+	openFileFunc   func(string, int, os.FileMode) (*os.File, error)
+	metadata       MetadataMode
+	tempFiles      TempFileMode
+	orphans        OrphanPolicy
+	compressor     *compressor
+	host           string
+	appVersion     string
+	onDiskFull     DiskFullPolicy
+	fallback       io.Writer
+	diskFullDrops  atomic.Uint64
+	recursivePrune bool
+	partition      string
+	anchored       bool
+	namePeriod     bool
+	reuse          bool
+	fileMode       os.FileMode
+	crashOutput    CrashOutput
+	reserved       map[string]bool
+	clock          Clock
+	strict         bool
+
+	softMaxFileSize int64
+	softMaxFiles    int
+	onThreshold     func(Threshold)
+	// stderr is the original stderr while RedirectStdio is in effect.
+	stderr atomic.Pointer[os.File]
+	births birthCache
+	index  *fileIndex
+	// open holds the files being written to, whose sizes the listings do
+	// not keep up with.
+	openMu sync.Mutex
+	open   map[string]*fileHandle
+
+	pruneMu         sync.Mutex
+	pendingRemovals map[string]struct{}
+	pruneFailures   atomic.Uint64
+	// spared holds the files about to be rotated away from that the prune
+	// before their rotation would have removed.
+	spared map[string]bool
+
+	generations atomic.Uint64
+
+	recordLatency   bool
+	coalesce        bool
+	mmap            bool
+	syncDir         bool
+	createDir       bool
+	audit           bool
+	rotationMarker  string
+	header          func(FileInfo) []byte
+	skipOpen        bool
+	manager         *DirectoryManager
+	writeLatency    histogram
+	rotationLatency histogram
+
+	nextDate int64
+}
+
+func newState(config Config) (*state, error) {
+	s := &state{
+		logDirectory:      config.Directory,
+		logFilenamePrefix: config.FilenamePrefix,
+		logFilenameSuffix: config.FilenameSuffix,
+		dateFormat:        config.DateFormat,
+		utcNames:          config.UTCFilenames,
+		noDelete:          config.NoDelete,
+		noBirthTime:       config.DisableBirthTime,
+		retention:         config.Retention,
+		logger:            config.InternalLogger,
+		rotation:          config.Rotation,
+		directIO:          config.DirectIO,
+		mirror:            config.Mirror,
+		ring:              config.RingBuffer,
+		maxFileSize:       config.MaxFileSize,
+		softMaxFileSize:   config.SoftMaxFileSize,
+		softMaxFiles:      config.SoftMaxFiles,
+		onThreshold:       config.OnThreshold,
+		maxLines:          config.MaxLinesPerFile,
+		pruneGlob:         config.PruneGlob,
+		pruneRegexp:       config.PruneRegexp,
+		pruneExclude:      config.PruneExclude,
+		beforeDelete:      config.BeforeDelete,
+		onRotate:          config.OnRotate,
+		retainers:         config.Retainers,
+		pidFile:           config.WritePidFile,
+		openFileFunc:      config.OpenFileFunc,
+		metadata:          config.Metadata,
+		tempFiles:         config.TempFiles,
+		orphans:           config.OrphanRecovery,
+		appVersion:        config.AppVersion,
+		onDiskFull:        config.OnDiskFull,
+		fallback:          config.FallbackWriter,
+		recursivePrune:    config.RecursivePrune || len(config.PartitionLayout) > 0,
+		partition:         config.PartitionLayout,
+		anchored:          config.AnchorToFirstWrite,
+		namePeriod:        config.NameByPeriodStart,
+		reuse:             config.ReusePeriodFile,
+		fileMode:          config.FileMode,
+		crashOutput:       config.CrashOutput,
+		reserved:          make(map[string]bool),
+		clock:             config.Clock,
+		strict:            config.StrictRotation,
+		recordLatency:     config.RecordLatency,
+		coalesce:          config.CoalesceWrites,
+		mmap:              config.Mmap && mmapSupported,
+		syncDir:           config.SyncDirectory,
+		createDir:         config.CreateDirectory || len(config.PartitionLayout) > 0,
+		audit:             config.AuditMode,
+		rotationMarker:    config.RotationMarker,
+		header:            config.Header,
+		skipOpen:          config.SkipOpenFiles,
+		pendingRemovals:   make(map[string]struct{}),
+		spared:            make(map[string]bool),
+		open:              make(map[string]*fileHandle),
+	}
+
+	if s.retention == nil && config.MaxFiles > 0 {
+		s.retention = KeepLastN(int(config.MaxFiles))
+	}
+
+	if _, err := path.Match(s.pruneGlob, ""); err != nil {
+		return nil, fmt.Errorf("invalid PruneGlob %q: %w", s.pruneGlob, err)
+	}
+
+	for _, pattern := range s.pruneExclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid PruneExclude pattern %q: %w", pattern, err)
+		}
+	}
+
+	if s.directIO && directIOFlag == 0 {
+		return nil, ErrDirectIOUnsupported
+	}
+
+	if s.directIO && s.mmap {
+		return nil, errors.New("rolling: DirectIO cannot be combined with Mmap")
+	}
+
+	if s.audit && (s.directIO || config.Mmap) {
+		return nil, errors.New("rolling: AuditMode cannot be combined with DirectIO or Mmap")
+	}
+	if s.audit {
+		if err := checkNoDelete(config, "AuditMode"); err != nil {
+			return nil, err
+		}
+		s.syncDir = true
+	}
+
+	if s.noDelete {
+		if err := checkNoDelete(config, "NoDelete"); err != nil {
+			return nil, err
+		}
+		s.reserved[s.deletionsFilename()] = true
+	}
+
+	if s.onDiskFull == DiskFullFallback && s.fallback == nil {
+		return nil, errors.New("rolling: DiskFullFallback needs a FallbackWriter")
+	}
+
+	if err := s.setupNaming(config); err != nil {
+		return nil, err
+	}
+
+	if s.fileMode == 0 {
+		s.fileMode = DefaultFileMode
+	}
+
+	if s.crashOutput == CrashOutputFile {
+		s.reserved[s.crashFilename()] = true
+	}
+
+	if s.metadata == MetadataXattr && !xattrSupported {
+		return nil, ErrXattrUnsupported
+	}
+	if s.metadata != MetadataOff {
+		s.host, _ = os.Hostname()
+	}
+
+	if config.Compress {
+		s.compressor = newCompressor(1, 0)
+	}
+
+	if config.MaxBytesPerInterval > 0 {
+		s.burst = &burstLimiter{max: config.MaxBytesPerInterval, interval: config.BurstInterval}
+		if s.burst.interval <= 0 {
+			s.burst.interval = DefaultBurstInterval
+		}
+	}
+
+	if s.pidFile {
+		s.reserved[s.pidFilename()] = true
+		s.reserved[s.pidFilename()+".tmp"] = true
+	}
+
+	if config.Upload != nil {
+		s.reserved[s.uploadQueueFilename()] = true
+		s.reserved[s.uploadQueueFilename()+".tmp"] = true
+	}
+
+	if config.PersistIndex {
+		s.reserved[s.indexFilename()] = true
+		s.reserved[s.indexFilename()+".tmp"] = true
+	}
+
+	if s.rotation != Never {
+		layout := s.dateFormat
+		if len(s.partition) > 0 {
+			layout = s.partition
+		}
+		if err := ValidateDateFormat(layout); err != nil {
+			s.logWarning("file names will not sort in time order", "err", err)
+		}
+	}
+
+	if len(s.logDirectory) == 0 {
+		pwd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+
+		s.logDirectory = pwd
+	}
+
+	if s.noDelete {
+		if err := s.loadDeletions(); err != nil {
+			return nil, fmt.Errorf("rolling: failed to read the deletion manifest: %w", err)
+		}
+	}
+
+	var err error
+	if config.IndexFiles {
+		if s.index, err = newFileIndex(s, config.IndexRescan, config.PersistIndex); err != nil {
+			return nil, fmt.Errorf("rolling: failed to read the file index: %w", err)
+		}
+	}
+
+	if config.Upload != nil {
+		if s.uploader, err = newUploader(s, config.Upload); err != nil {
+			return nil, fmt.Errorf("rolling: failed to read the upload queue: %w", err)
+		}
+		s.retainers = append(s.retainers[:len(s.retainers):len(s.retainers)], s.uploader)
+	}
+
+	if nextDate := s.rotation.NextDate(s.getNow()); nextDate != nil {
+		s.nextDate = nextDate.UnixNano()
+		s.rotates = true
+
+		if s.anchored {
+			s.nextDate = pendingAnchor
+		}
+	}
+
+	return s, nil
+}
+
+// setupNaming sets the location, date format and name prefix the file
+// names are parsed and joined with, checking that they tell the periods
+// apart.
+func (s *state) setupNaming(config Config) error {
+	loc := config.TimeLocation
+	if loc == nil && len(config.TimeZone) > 0 {
+		var err error
+		if loc, err = time.LoadLocation(config.TimeZone); err != nil {
+			return fmt.Errorf("rolling: unknown TimeZone %q: %w", config.TimeZone, err)
+		}
+	}
+
+	if loc == nil {
+		loc = time.UTC
+	}
+	s.location.Store(loc)
+
+	if s.namePeriod && s.anchored {
+		return errors.New("rolling: NameByPeriodStart cannot be combined with AnchorToFirstWrite")
+	}
+
+	if len(s.dateFormat) == 0 && s.namePeriod {
+		s.dateFormat = periodDateFormats[s.rotation]
+	}
+
+	if len(s.dateFormat) == 0 {
+		switch s.rotation {
+		case ISOWeekly:
+			s.dateFormat = "%G-W%V"
+		case Yearly:
+			s.dateFormat = "2006"
+		default:
+			s.dateFormat = DefaultDateFormat + fractionLayout(s.rotation)
+		}
+	}
+
+	if len(s.partition) > 0 {
+		if len(s.logFilenamePrefix) == 0 && len(s.logFilenameSuffix) == 0 {
+			return errors.New("rolling: PartitionLayout needs a FilenamePrefix or FilenameSuffix")
+		}
+
+		r, ok := s.rotation.(PeriodicRotation)
+		if !ok || s.rotation == Never || s.anchored {
+			return errors.New("rolling: PartitionLayout needs a periodic rotation")
+		}
+		if collides(r, s.partition, loc) {
+			return fmt.Errorf("%w: PartitionLayout %q for %v", ErrDateFormatCollision, s.partition, s.rotation)
+		}
+	} else if r, ok := s.rotation.(PeriodicRotation); ok && s.rotation != Never && !s.anchored {
+		if collides(r, s.dateFormat, loc) {
+			extended, ok := extendDateFormat(r, s.dateFormat, loc)
+			if !config.ExtendDateFormat || !ok {
+				return fmt.Errorf("%w: %q for %v", ErrDateFormatCollision, s.dateFormat, s.rotation)
+			}
+			s.dateFormat = extended
+		}
+	}
+
+	labels, err := filenameLabels(config)
+	if err != nil {
+		return err
+	}
+
+	s.namePrefix = s.logFilenamePrefix + labels
+	if len(labels) > 0 && s.rotation != Never && len(s.partition) == 0 {
+		s.namePrefix += "."
+	}
+
+	return nil
+}
+
+// newNamingState returns a state with just what parsing and joining file
+// names needs, for the helpers working on names alone: unlike newState it
+// touches neither the working directory nor the files kept next to the
+// logs.
+func newNamingState(config Config) (*state, error) {
+	s := &state{
+		logDirectory:      config.Directory,
+		logFilenamePrefix: config.FilenamePrefix,
+		logFilenameSuffix: config.FilenameSuffix,
+		dateFormat:        config.DateFormat,
+		utcNames:          config.UTCFilenames,
+		logger:            config.InternalLogger,
+		rotation:          config.Rotation,
+		partition:         config.PartitionLayout,
+		anchored:          config.AnchorToFirstWrite,
+		namePeriod:        config.NameByPeriodStart,
+	}
+
+	if err := s.setupNaming(config); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// periodDateFormats are the default date formats with NameByPeriodStart,
+// just precise enough to tell the periods apart.
+var periodDateFormats = map[Rotation]string{
+	Secondly:  "20060102150405",
+	Minutely:  "200601021504",
+	Hourly:    "2006010215",
+	Daily:     "20060102",
+	ISOWeekly: "%G-W%V",
+	Yearly:    "2006",
+}
+
+// fractionLayout returns the fractional seconds needed to tell the files of
+// a sub-second rotation apart.
+func fractionLayout(r Rotation) string {
+	every, ok := r.(rotation)
+	if !ok || every.kind != 7 || every.every%time.Second == 0 {
+		return ""
+	}
+
+	switch {
+	case every.every%time.Millisecond == 0:
+		return ".000"
+	case every.every%time.Microsecond == 0:
+		return ".000000"
+	default:
+		return ".000000000"
+	}
+}
+
+func filenameLabels(config Config) (string, error) {
+	var parts []string
+	if config.IncludeHostname {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, hostname)
+	}
+
+	keys := make([]string, 0, len(config.Labels))
+	for key := range config.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		parts = append(parts, key+"="+config.Labels[key])
+	}
+
+	return labelReplacer.Replace(strings.Join(parts, ".")), nil
+}
+
+var labelReplacer = strings.NewReplacer("/", "_", "\\", "_")
+
+func (s *state) getNow() time.Time {
+	if s.clock != nil {
+		return s.clock.Now().In(s.location.Load())
+	}
+
+	return time.Now().In(s.location.Load())
+}
+
+// unixNano is getNow().UnixNano() without the location conversion.
+func (s *state) unixNano() int64 {
+	if s.clock != nil {
+		return s.clock.Now().UnixNano()
+	}
+
+	return time.Now().UnixNano()
+}
+
+type logEntry struct {
+	Name     string
+	FullPath string
+	Ctime    time.Time
+	// Seq orders the files of a period with DisableBirthTime.
+	Seq int
+	// Size and ModTime are as of the scan that found the file, or the
+	// last time the appender closed it.
+	Size    int64
+	ModTime time.Time
+}
+
+// pruneStatLimit caps the files a pass of pruning stats for the first
+// time. A pass over the limit removes nothing and leaves the rest to the
+// following passes, which find the files stat-ed so far in the cache.
+const pruneStatLimit = 4096
+
+// birthCache holds the entries of the files seen by the last listing, so
+// that a listing stats only the files it has not seen before. Birth times
+// do not change; sizes and modification times are updated as the appender
+// closes the files it writes to. Files without a birth time are held with
+// the zero time.
+type birthCache struct {
+	mu      sync.Mutex
+	entries map[string]logEntry
+	// stats counts the files stat-ed by the current listing.
+	stats int
+}
+
+// forget drops name, which has been removed, so that a new file of the
+// same name is stat-ed again.
+func (c *birthCache) forget(name string) {
+	c.mu.Lock()
+	delete(c.entries, name)
+	c.mu.Unlock()
+}
+
+// update records the size and modification time of name, if cached.
+func (c *birthCache) update(name string, size int64, mtime time.Time) {
+	c.mu.Lock()
+	if entry, ok := c.entries[name]; ok {
+		entry.Size, entry.ModTime = size, mtime
+		c.entries[name] = entry
+	}
+	c.mu.Unlock()
+}
+
+// opened records h as being written to.
+func (s *state) opened(h *fileHandle) {
+	s.openMu.Lock()
+	s.open[h.name] = h
+	s.openMu.Unlock()
+}
+
+// closed drops h, just closed, and records the final size and modification
+// time of its file for the listings.
+func (s *state) closed(h *fileHandle) {
+	s.openMu.Lock()
+	if s.open[h.name] == h {
+		delete(s.open, h.name)
+	}
+	s.openMu.Unlock()
+
+	s.refreshEntry(h.name)
+}
+
+// refreshEntry stats name for its cached and indexed entries.
+func (s *state) refreshEntry(name string) {
+	info, err := os.Stat(path.Join(s.logDirectory, name))
+	if err != nil {
+		return
+	}
+
+	s.births.update(name, info.Size(), info.ModTime())
+	if s.index != nil {
+		s.index.update(s, name, info.Size(), info.ModTime())
+	}
+}
+
+// listLogs returns the log files in the directory, oldest first.
+func (s *state) listLogs() ([]*logEntry, error) {
+	files, _, err := s.scanLogs(0)
+	return files, err
+}
+
+// scanLogs is listLogs stat-ing at most limit files missing from the
+// cache, when limit is positive. It reports whether no file was left out.
+func (s *state) scanLogs(limit int) ([]*logEntry, bool, error) {
+	if s.index != nil {
+		if files, ok := s.index.fresh(s.getNow()); ok {
+			return files, true, nil
+		}
+	}
+
+	return s.readLogs(limit)
+}
+
+// readLogs is scanLogs reading the directory even when the index is fresh.
+func (s *state) readLogs(limit int) ([]*logEntry, bool, error) {
+	s.births.mu.Lock()
+	defer s.births.mu.Unlock()
+
+	previous := s.births.entries
+	s.births.entries = make(map[string]logEntry, len(previous))
+	s.births.stats = 0
+
+	var files []*logEntry
+	complete := true
+	err := s.walkLogs(func(name string) {
+		if _, cached := previous[name]; !cached && limit > 0 && s.births.stats >= limit {
+			complete = false
+			return
+		}
+
+		entry := &logEntry{Name: name, FullPath: path.Join(s.logDirectory, name)}
+		if s.created(entry, previous) {
+			files = append(files, entry)
+		}
+	})
+	if err != nil {
+		s.births.entries = previous
+		return nil, false, err
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return entryBefore(files[i], files[j])
+	})
+
+	if s.index != nil && complete {
+		s.index.replace(s, files, s.getNow())
+	}
+
+	return files, complete, nil
+}
+
+func entryBefore(a, b *logEntry) bool {
+	if !a.Ctime.Equal(b.Ctime) {
+		return a.Ctime.Before(b.Ctime)
+	}
+
+	return a.Seq < b.Seq
+}
+
+// created fills in entry, looking it up in cached first, and reports
+// false for files whose time is unknown.
+func (s *state) created(entry *logEntry, cached map[string]logEntry) bool {
+	if c, ok := cached[entry.Name]; ok {
+		*entry = c
+	} else {
+		s.births.stats++
+		if err := s.statEntry(entry); err != nil {
+			s.logError("failed to read file", err)
+			return false
+		}
+	}
+	s.births.entries[entry.Name] = *entry
+
+	return !entry.Ctime.IsZero()
+}
+
+// statEntry sets the size and modification time of entry, and the time it
+// is ordered by: its birth time or, with DisableBirthTime, the date in its
+// name, falling back to its modification time. Archives are ordered by the
+// date in their names either way, since they are born when compressed,
+// after files rotated later. The time is left zero for files without a
+// birth time.
+func (s *state) statEntry(entry *logEntry) error {
+	info, err := os.Stat(entry.FullPath)
+	if err != nil {
+		return err
+	}
+	entry.Size, entry.ModTime = info.Size(), info.ModTime()
+
+	byName := s.noBirthTime || !birthTimes
+	if _, archived := trimArchiveExt(entry.Name); byName || archived {
+		date, seq, ok := s.parseFilename(entry.Name)
+		if ok && !date.IsZero() {
+			entry.Ctime, entry.Seq = date, seq
+			return nil
+		}
+		if byName {
+			entry.Ctime, entry.Seq = entry.ModTime, seq
+			return nil
+		}
+	}
+
+	entry.Ctime, _, err = birthTime(entry.FullPath)
+	return err
+}
+
+// walkLogs calls fn with the slash separated path, relative to the log
+// directory, of every file belonging to the appender. Subdirectories are
+// only visited with RecursivePrune.
+func (s *state) walkLogs(fn func(name string)) error {
+	return s.walkFiles(s.matches, fn)
+}
+
+// walkFiles is walkLogs for the files whose base name satisfies match.
+func (s *state) walkFiles(match func(filename string) bool, fn func(name string)) error {
+	if !s.recursivePrune {
+		entries, err := os.ReadDir(s.logDirectory)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			if !entry.IsDir() && match(entry.Name()) {
+				fn(entry.Name())
+			}
+		}
+
+		return nil
+	}
+
+	return filepath.WalkDir(s.logDirectory, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if p == s.logDirectory {
+				return err
+			}
+			s.logError("failed to read dir", err)
+			return nil
+		}
+
+		if entry.IsDir() || !match(entry.Name()) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.logDirectory, p)
+		if err != nil {
+			return nil
+		}
+		fn(filepath.ToSlash(rel))
+
+		return nil
+	})
+}
+
+// removeEmptyDirs removes the parent directories of name that have become
+// empty, stopping at the log directory.
+func (s *state) removeEmptyDirs(name string) {
+	for dir := path.Dir(name); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if err := os.Remove(path.Join(s.logDirectory, dir)); err != nil {
+			return
+		}
+	}
+}
+
+// matches reports whether filename belongs to this appender. PruneGlob and
+// PruneRegexp take precedence over the prefix and suffix. Reserved names,
+// such as the crash file, never match.
+func (s *state) matches(filename string) bool {
+	if s.reserved[filename] || s.isSidecar(filename) || s.isTemp(filename) {
+		return false
+	}
+
+	if len(s.pruneGlob) > 0 || s.pruneRegexp != nil {
+		if len(s.pruneGlob) > 0 {
+			if ok, _ := path.Match(s.pruneGlob, filename); !ok {
+				return false
+			}
+		}
+
+		return s.pruneRegexp == nil || s.pruneRegexp.MatchString(filename)
+	}
+
+	stem, _ := trimArchiveExt(filename)
+	if len(s.logFilenamePrefix) > 0 && !strings.HasPrefix(stem, s.logFilenamePrefix) {
+		return false
+	}
+
+	if len(s.logFilenameSuffix) > 0 && !strings.HasSuffix(stem, s.logFilenameSuffix) {
+		return false
+	}
+
+	return !s.yields(stem)
+}
+
+// excludeProtected drops the files matching PruneExclude, which are never
+// pruned and do not count towards the retention.
+func (s *state) excludeProtected(files []*logEntry) []*logEntry {
+	if len(s.pruneExclude) == 0 {
+		return files
+	}
+
+	kept := files[:0]
+	for _, file := range files {
+		if !s.protected(file.Name) {
+			kept = append(kept, file)
+		}
+	}
+
+	return kept
+}
+
+// protected reports whether name, relative to the log directory, matches
+// PruneExclude. Patterns without a slash match the base name, so that
+// "*-audit-*" also protects files in subdirectories.
+func (s *state) protected(name string) bool {
+	for _, pattern := range s.pruneExclude {
+		target := name
+		if !strings.Contains(pattern, "/") {
+			target = path.Base(name)
+		}
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// archiveExtensions are appended to log files by compression or
+// encryption, possibly several at once as in ".gz.enc".
+var archiveExtensions = []string{".gz", ".zst", ".enc"}
+
+// trimArchiveExt strips the archive extensions from name and reports
+// whether there were any.
+func trimArchiveExt(name string) (string, bool) {
+	archived := false
+	for {
+		trimmed := false
+		for _, ext := range archiveExtensions {
+			if strings.HasSuffix(name, ext) {
+				name = strings.TrimSuffix(name, ext)
+				archived, trimmed = true, true
+			}
+		}
+
+		if !trimmed {
+			return name, archived
+		}
+	}
+}
+
+// prune_old_logs removes the oldest log files until at most keep are left.
+// Files that could not be removed are retried on every following pass
+// until they are gone. The active file is spared, and removed by
+// pruneSpared once rotated away from.
+func (s *state) prune_old_logs(reserve bool, active string) ([]string, error) {
+	if s.retention == nil || s.audit {
+		return nil, nil
+	}
+
+	s.pruneMu.Lock()
+	defer s.pruneMu.Unlock()
+
+	removed := s.retryRemovals()
+
+	files, complete, err := s.scanLogs(pruneStatLimit)
+	if err != nil {
+		return removed, fmt.Errorf("failed to read dir: %w", err)
+	}
+	if !complete {
+		// Without the files left out the retention could keep the wrong
+		// ones.
+		s.logEvent("deferred pruning to stat more files", "limit", pruneStatLimit)
+		return removed, nil
+	}
+
+	files = s.excludeProtected(files)
+
+	// Files still pending removal do not count towards the retention.
+	kept := files[:0]
+	for _, file := range files {
+		if _, ok := s.pendingRemovals[file.Name]; !ok {
+			kept = append(kept, file)
+		}
+	}
+	files = kept
+
+	candidates := s.skipOpenElsewhere(s.unretained(files, s.retention, reserve))
+	for _, file := range candidates {
+		if file.Name == active {
+			s.spared[active] = true
+			continue
+		}
+		if s.removeLog(file) {
+			removed = append(removed, file.Name)
+		}
+	}
+
+	s.syncParents(removed)
+
+	return removed, nil
+}
+
+// skipOpenElsewhere leaves out the files other processes have open with
+// SkipOpenFiles. They are retried on the next pass.
+func (s *state) skipOpenElsewhere(files []*logEntry) []*logEntry {
+	if !s.skipOpen || len(files) == 0 {
+		return files
+	}
+
+	paths := make([]string, len(files))
+	for i, file := range files {
+		paths[i] = file.FullPath
+	}
+	open := openElsewhere(paths)
+
+	kept := make([]*logEntry, 0, len(files))
+	for _, file := range files {
+		if !open[file.FullPath] {
+			kept = append(kept, file)
+		}
+	}
+
+	return kept
+}
+
+// retryRemovals removes the files earlier passes failed to remove, and
+// returns the names of those now gone. The caller holds pruneMu.
+func (s *state) retryRemovals() []string {
+	if s.noDelete {
+		s.forgetDeleted()
+		return nil
+	}
+
+	var removed []string
+	for name := range s.pendingRemovals {
+		err := os.Remove(path.Join(s.logDirectory, name))
+		if err == nil || errors.Is(err, fs.ErrNotExist) {
+			delete(s.pendingRemovals, name)
+			s.indexRemoved(name, "")
+			if err == nil {
+				removed = append(removed, name)
+				s.removeMetadata(path.Join(s.logDirectory, name))
+				s.cleanupDirs(name)
+			}
+			continue
+		}
+		s.pruneFailures.Add(1)
+		s.logError("failed to remove the log entry", err)
+	}
+
+	return removed
+}
+
+// removeLog removes a file for pruning, consulting BeforeDelete first, and
+// reports whether it is gone. The caller holds pruneMu.
+func (s *state) removeLog(file *logEntry) bool {
+	return len(s.deleteLog(file)) == 0
+}
+
+// deleteLog is removeLog returning why file was not removed, or the empty
+// string once it is gone.
+func (s *state) deleteLog(file *logEntry) string {
+	for _, retainer := range s.retainers {
+		if !retainer.MayDelete(file.FullPath) {
+			return "held by a Retainer"
+		}
+	}
+
+	if s.beforeDelete != nil {
+		ok, err := s.beforeDelete(s.fileInfo(file.Name))
+		if err != nil {
+			s.logError("failed to prepare the log entry for removal", err)
+			return "BeforeDelete failed: " + err.Error()
+		}
+		if !ok {
+			return "vetoed by BeforeDelete"
+		}
+	}
+
+	if s.noDelete {
+		return s.requestDeletion(file)
+	}
+
+	err := os.Remove(file.FullPath)
+	s.births.forget(file.Name)
+	if err == nil || errors.Is(err, fs.ErrNotExist) {
+		s.indexRemoved(file.Name, "")
+	}
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			s.pruneFailures.Add(1)
+			s.pendingRemovals[file.Name] = struct{}{}
+		}
+		s.logError("failed to remove the log entry", err, "file", file.Name)
+		return "failed to remove: " + err.Error()
+	}
+	s.removeMetadata(file.FullPath)
+	s.cleanupDirs(file.Name)
+	s.logEvent("pruned the log file", "file", file.Name)
+
+	return ""
+}
+
+// cleanupDirs cleans up after removing name with RecursivePrune.
+func (s *state) cleanupDirs(name string) {
+	if s.recursivePrune {
+		s.removeEmptyDirs(name)
+	}
+}
+
+// syncParents syncs the directories of the named files with
+// SyncDirectory, up to Directory, as directories emptied by RecursivePrune
+// are gone too.
+func (s *state) syncParents(names []string) {
+	if !s.syncDir {
+		return
+	}
+
+	dirs := make(map[string]bool)
+	for _, name := range names {
+		for dir := path.Dir(name); ; dir = path.Dir(dir) {
+			dirs[dir] = true
+			if dir == "." || dir == "/" {
+				break
+			}
+		}
+	}
+
+	for dir := range dirs {
+		err := syncDir(path.Join(s.logDirectory, dir))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			s.logError("failed to sync the log directory", err)
+		}
+	}
+}
+
+// syncDir commits the entries of a directory to stable storage.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		// Directories cannot be synced on Windows.
+		return nil
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+func (s *state) createFile(date time.Time, seq int) (*fileHandle, error) {
+	var filename = s.joinDate(date, seq)
+
+	var flag int
+	if s.directIO {
+		flag = directIOFlag
+	}
+	if s.mmap {
+		// Shared writable mappings need the file open for reading too.
+		flag = os.O_RDWR
+	}
+
+	// A file that already exists, e.g. for ReusePeriodFile, is appended to
+	// under its name.
+	name, temp := filename, false
+	if s.tempFiles != TempFilesOff {
+		if _, err := os.Lstat(path.Join(s.logDirectory, filename)); errors.Is(err, fs.ErrNotExist) {
+			name, temp = filename+tempExt, true
+		}
+	}
+
+	file, err := s.openLogFile(name, flag)
+	if errors.Is(err, fs.ErrNotExist) && s.createDir {
+		if err := os.MkdirAll(path.Dir(path.Join(s.logDirectory, filename)), 0755); err != nil {
+			return nil, err
+		}
+		file, err = s.openLogFile(name, flag)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := newFileHandle(file, s.directIO, s.mmap, date, seq)
+	if err != nil {
+		return nil, err
+	}
+	h.state = s
+	h.temp.Store(temp)
+
+	if s.syncDir && h.size.Load() == 0 {
+		if err := syncDir(path.Dir(path.Join(s.logDirectory, filename))); err != nil {
+			h.release()
+			return nil, err
+		}
+	}
+
+	if s.maxLines > 0 && h.size.Load() > 0 {
+		lines, err := countFileLines(path.Join(s.logDirectory, name), h.size.Load())
+		if err != nil {
+			h.release()
+			return nil, err
+		}
+		h.lines.Store(lines)
+	}
+
+	h.name = filename
+	if s.header != nil && h.size.Load() == 0 {
+		if header := s.header(s.fileInfo(filename)); len(header) > 0 {
+			if _, err := h.Write(header); err != nil {
+				h.release()
+				return nil, err
+			}
+			h.lines.Add(s.countLines(header))
+		}
+	}
+	h.generation = s.generations.Add(1)
+	s.opened(h)
+	if !temp {
+		s.indexCreated(filename)
+	}
+	if s.onRotate != nil || s.uploader != nil || s.metadata != MetadataOff || s.compressor != nil || s.retention != nil || s.onThreshold != nil {
+		h.onRotate = s.rotated
+	}
+
+	return h, nil
+}
+
+// rotated hands a file that has been rotated away from and closed to the
+// metadata stamping, the upload queue, OnRotate and compression, in that
+// order. With Upload, files are compressed once shipped.
+func (s *state) rotated(name string) {
+	if s.metadata != MetadataOff {
+		s.stampMetadata(s.fileInfo(name))
+	}
+	if s.uploader != nil {
+		s.uploader.enqueue(name)
+	}
+	if s.onRotate != nil {
+		s.onRotate(s.fileInfo(name))
+	}
+	s.checkSoftFiles(name)
+	if s.uploader != nil {
+		return
+	}
+	if !s.pruneSpared(name) && s.compressor != nil {
+		s.compressor.enqueue(s, name)
+	}
+}
+
+// pruneSpared prunes again after name, spared by the prune before its
+// rotation, has been rotated away from and shipped, as with a MaxFiles
+// of 1. It reports whether name was removed.
+func (s *state) pruneSpared(name string) bool {
+	s.pruneMu.Lock()
+	spared := s.spared[name]
+	delete(s.spared, name)
+	s.pruneMu.Unlock()
+
+	if !spared {
+		return false
+	}
+
+	removed, err := s.prune_old_logs(false, "")
+	if err != nil {
+		s.logError("failed to prune", err)
+	}
+
+	return slices.Contains(removed, name)
+}
+
+// lastSequence returns the highest sequence number of the existing files
+// for date, so that a restart continues the sequence instead of writing
+// to a file that has already been rotated away from.
+func (s *state) lastSequence(date time.Time) int {
+	if !s.sequenced() {
+		return 0
+	}
+
+	// With PartitionLayout the files of date are in a directory of their
+	// own.
+	dir := path.Dir(s.joinDate(date, 0))
+	entries, err := os.ReadDir(path.Join(s.logDirectory, dir))
+	if err != nil {
+		return 0
+	}
+
+	// Sequences are not contiguous once the older files of the period have
+	// been pruned, so the highest one found is taken.
+	base := s.joinDate(date, 0)
+	var last int
+	for _, entry := range entries {
+		stem, _ := trimArchiveExt(entry.Name())
+		d, seq, ok := s.parseFilename(path.Join(dir, stem))
+		if ok && seq > last && s.joinDate(d, 0) == base {
+			last = seq
+		}
+	}
+
+	return last
+}
+
+// shouldRollover reports whether the unix time in nanoseconds has crossed
+// the next rotation boundary, returning the boundary that was crossed.
+func (s *state) shouldRollover(unixNano int64) (int64, bool) {
+	var nextDate = atomic.LoadInt64(&s.nextDate)
+	if nextDate == 0 || unixNano < nextDate {
+		return 0, false
+	}
+
+	return nextDate, true
+}
+
+func (s *state) AdvanceDate(now time.Time, current int64) bool {
+	return atomic.CompareAndSwapInt64(&s.nextDate, current, s.nextBoundary(now))
+}
+
+// pendingAnchor marks a file that has not been written to yet when the
+// rotation window is anchored at the first write. Every time is past it,
+// so the next write will compute the real boundary.
+const pendingAnchor = -1
+
+// nextBoundary returns the unix time in nanoseconds of the rotation
+// boundary following now, or 0 when the rotation has no further boundary.
+func (s *state) nextBoundary(now time.Time) int64 {
+	var next = s.rotation.NextDate(now)
+	if r, ok := s.rotation.(windowRotation); ok && s.anchored {
+		next = r.nextWindow(now)
+	}
+
+	if next == nil {
+		return 0
+	}
+
+	return next.UnixNano()
+}
+
+func (s *state) joinDate(date time.Time, seq int) string {
+	var seqStr string
+	if seq > 0 {
+		seqStr = "." + strconv.Itoa(seq)
+	}
+
+	if r, ok := s.rotation.(PeriodicRotation); ok && s.namePeriod && s.rotation != Never {
+		date = r.Round(date)
+	}
+
+	if len(s.partition) > 0 {
+		if r, ok := s.rotation.(PeriodicRotation); ok {
+			date = r.Round(date)
+		}
+		return path.Join(s.formatName(date, s.partition), s.undatedName(seqStr))
+	}
+
+	dateStr := s.formatName(date, s.dateFormat) + seqStr
+
+	switch s.rotation {
+	case Never:
+		if name := s.undatedName(seqStr); len(name) > 0 {
+			return name
+		}
+
+	default:
+		if len(s.namePrefix) > 0 && len(s.logFilenameSuffix) > 0 {
+			return s.namePrefix + dateStr + s.logFilenameSuffix
+		}
+		if len(s.namePrefix) > 0 {
+			return s.namePrefix + dateStr
+		}
+		if len(s.logFilenameSuffix) > 0 {
+			return dateStr + s.logFilenameSuffix
+		}
+	}
+
+	return dateStr
+}
+
+// undatedName is the file name for Never and PartitionLayout, empty without
+// a prefix or suffix.
+func (s *state) undatedName(seqStr string) string {
+	switch {
+	case len(s.namePrefix) > 0 && len(s.logFilenameSuffix) > 0:
+		return s.namePrefix + seqStr + s.logFilenameSuffix
+	case len(s.namePrefix) > 0:
+		return s.namePrefix + seqStr
+	case len(s.logFilenameSuffix) > 0:
+		return strings.TrimPrefix(seqStr, ".") + s.logFilenameSuffix
+	}
+
+	return ""
 }
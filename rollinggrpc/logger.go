@@ -0,0 +1,123 @@
+// Package rollinggrpc provides a gRPC logger backed by rolling appenders.
+//
+// Logger implements grpclog.LoggerV2 without this module depending on
+// gRPC; install it with grpclog.SetLoggerV2.
+package rollinggrpc
+
+import (
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/importcjj/rolling"
+)
+
+const (
+	infoLevel = iota
+	warningLevel
+	errorLevel
+	fatalLevel
+)
+
+var severityNames = []string{"INFO", "WARNING", "ERROR", "FATAL"}
+
+// Logger routes gRPC's log output by severity.
+type Logger struct {
+	loggers   [4]*log.Logger
+	verbosity int
+}
+
+// NewLogger returns a Logger writing every message to the writer of its
+// severity and to the writers of the lower severities, as gRPC's built-in
+// logger does: info receives everything, errors only errors and fatal
+// messages. Nil writers discard their output. Messages at a verbosity
+// level above verbosity are not logged.
+func NewLogger(info, warning, errors io.Writer, verbosity int) *Logger {
+	writers := []io.Writer{info, warning, errors, errors}
+
+	l := &Logger{verbosity: verbosity}
+	for level := range l.loggers {
+		var dsts []io.Writer
+		for _, w := range writers[:level+1] {
+			if w != nil && !contains(dsts, w) {
+				dsts = append(dsts, w)
+			}
+		}
+
+		var w io.Writer = io.Discard
+		if len(dsts) > 0 {
+			w = io.MultiWriter(dsts...)
+		}
+		l.loggers[level] = log.New(w, severityNames[level]+": ", log.LstdFlags)
+	}
+
+	return l
+}
+
+func contains(writers []io.Writer, w io.Writer) bool {
+	for _, x := range writers {
+		if x == w {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (l *Logger) Info(args ...interface{}) {
+	l.loggers[infoLevel].Output(2, fmt.Sprint(args...))
+}
+
+func (l *Logger) Infoln(args ...interface{}) {
+	l.loggers[infoLevel].Output(2, fmt.Sprintln(args...))
+}
+
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.loggers[infoLevel].Output(2, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Warning(args ...interface{}) {
+	l.loggers[warningLevel].Output(2, fmt.Sprint(args...))
+}
+
+func (l *Logger) Warningln(args ...interface{}) {
+	l.loggers[warningLevel].Output(2, fmt.Sprintln(args...))
+}
+
+func (l *Logger) Warningf(format string, args ...interface{}) {
+	l.loggers[warningLevel].Output(2, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Error(args ...interface{}) {
+	l.loggers[errorLevel].Output(2, fmt.Sprint(args...))
+}
+
+func (l *Logger) Errorln(args ...interface{}) {
+	l.loggers[errorLevel].Output(2, fmt.Sprintln(args...))
+}
+
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.loggers[errorLevel].Output(2, fmt.Sprintf(format, args...))
+}
+
+// Fatal, Fatalln and Fatalf exit through rolling.Exit, syncing the
+// appenders registered with rolling.FlushOnExit.
+func (l *Logger) Fatal(args ...interface{}) {
+	l.loggers[fatalLevel].Output(2, fmt.Sprint(args...))
+	rolling.Exit(1)
+}
+
+func (l *Logger) Fatalln(args ...interface{}) {
+	l.loggers[fatalLevel].Output(2, fmt.Sprintln(args...))
+	rolling.Exit(1)
+}
+
+func (l *Logger) Fatalf(format string, args ...interface{}) {
+	l.loggers[fatalLevel].Output(2, fmt.Sprintf(format, args...))
+	rolling.Exit(1)
+}
+
+// V reports whether messages at verbosity level are logged.
+func (l *Logger) V(level int) bool {
+	return level <= l.verbosity
+}
@@ -0,0 +1,129 @@
+package rollinghttp
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AccessLogMiddleware logs every request to w, typically a rolling
+// appender, in the Apache/Nginx combined log format.
+func AccessLogMiddleware(w io.Writer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			start := time.Now()
+			rec := &responseRecorder{ResponseWriter: rw}
+			next.ServeHTTP(rec, req)
+
+			w.Write(combinedLogLine(req, rec.status, rec.size, start))
+		})
+	}
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *responseRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hands over the connection, e.g. for a WebSocket upgrade, which is
+// logged as 101 unless a status was written.
+func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+
+	conn, rw, err := h.Hijack()
+	if err == nil && r.status == 0 {
+		r.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+func (r *responseRecorder) Push(target string, opts *http.PushOptions) error {
+	if p, ok := r.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// Unwrap gives http.ResponseController access to the other methods of the
+// ResponseWriter.
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func combinedLogLine(req *http.Request, status int, size int64, start time.Time) []byte {
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+
+	user := "-"
+	if u, _, ok := req.BasicAuth(); ok && len(u) > 0 {
+		user = escape(u)
+	}
+
+	bytesSent := "-"
+	if size > 0 {
+		bytesSent = strconv.FormatInt(size, 10)
+	}
+
+	var b bytes.Buffer
+	b.WriteString(host)
+	b.WriteString(" - ")
+	b.WriteString(user)
+	b.WriteString(" [")
+	b.WriteString(start.Format("02/Jan/2006:15:04:05 -0700"))
+	b.WriteString("] \"")
+	b.WriteString(escape(req.Method + " " + req.RequestURI + " " + req.Proto))
+	b.WriteString("\" ")
+	b.WriteString(strconv.Itoa(status))
+	b.WriteByte(' ')
+	b.WriteString(bytesSent)
+	b.WriteString(" \"")
+	b.WriteString(escape(req.Referer()))
+	b.WriteString("\" \"")
+	b.WriteString(escape(req.UserAgent()))
+	b.WriteString("\"\n")
+
+	return b.Bytes()
+}
+
+var logEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+func escape(s string) string {
+	return logEscaper.Replace(s)
+}
@@ -0,0 +1,122 @@
+package rollinghttp
+
+import (
+	"compress/gzip"
+	"crypto/subtle"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/importcjj/rolling"
+)
+
+type FileServerConfig struct {
+	// Username and Password require HTTP basic auth when Username is set.
+	Username string
+	Password string
+}
+
+type fileServer struct {
+	appender *rolling.RollingFileAppender
+	fsys     fs.FS
+	config   FileServerConfig
+}
+
+// NewFileServer returns a read-only handler serving the files of the
+// appender's FS: the root lists them as JSON, oldest first, and every
+// other path serves the file of that name with Range support. Gzipped
+// archives are sent as they are with Content-Encoding: gzip, or
+// decompressed for clients that do not accept gzip.
+func NewFileServer(appender *rolling.RollingFileAppender, config FileServerConfig) http.Handler {
+	return &fileServer{appender: appender, fsys: appender.FS(), config: config}
+}
+
+func (s *fileServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !s.authorized(req) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="logs"`)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+req.URL.Path), "/")
+	if name == "" {
+		names, err := s.appender.Files()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if names == nil {
+			names = []string{}
+		}
+		writeJSON(w, names)
+		return
+	}
+
+	file, err := s.fsys.Open(name)
+	if err != nil {
+		http.NotFound(w, req)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, req)
+		return
+	}
+
+	content, ok := file.(io.ReadSeeker)
+	if !ok {
+		http.Error(w, "file does not support seeking", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	if !strings.HasSuffix(name, ".gz") {
+		http.ServeContent(w, req, "", info.ModTime(), content)
+		return
+	}
+
+	w.Header().Set("Vary", "Accept-Encoding")
+	if strings.Contains(req.Header.Get("Accept-Encoding"), "gzip") {
+		// Ranges then apply to the compressed bytes, as they should.
+		w.Header().Set("Content-Encoding", "gzip")
+		http.ServeContent(w, req, "", info.ModTime(), content)
+		return
+	}
+
+	gz, err := gzip.NewReader(content)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer gz.Close()
+
+	if req.Method != http.MethodHead {
+		io.Copy(w, gz)
+	}
+}
+
+func (s *fileServer) authorized(req *http.Request) bool {
+	if len(s.config.Username) == 0 {
+		return true
+	}
+
+	user, password, ok := req.BasicAuth()
+	if !ok {
+		return false
+	}
+
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(s.config.Username)) == 1
+	passwordOK := subtle.ConstantTimeCompare([]byte(password), []byte(s.config.Password)) == 1
+	return userOK && passwordOK
+}
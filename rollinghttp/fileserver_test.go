@@ -0,0 +1,62 @@
+package rollinghttp_test
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/importcjj/rolling"
+	"github.com/importcjj/rolling/rollinghttp"
+)
+
+func TestFileServerRange(t *testing.T) {
+	f := newFixture(t, rolling.Config{})
+	f.Write("0123456789\n")
+	s := rollinghttp.NewFileServer(f.Appender, rollinghttp.FileServerConfig{})
+
+	rec := serve(s, http.MethodGet, "/2024010100.log", http.Header{"Range": {"bytes=2-4"}})
+	if got := rec.Body.String(); rec.Code != http.StatusPartialContent || got != "234" {
+		t.Errorf("got status %d and %q", rec.Code, got)
+	}
+}
+
+func TestFileServerArchive(t *testing.T) {
+	f := newFixture(t, rolling.Config{Compress: true})
+	f.Write("archived\n")
+	name := archive(t, f)
+	s := rollinghttp.NewFileServer(f.Appender, rollinghttp.FileServerConfig{})
+
+	raw, err := os.ReadFile(filepath.Join(f.Dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ranges of an archive sent as it is cover the compressed bytes.
+	rec := serve(s, http.MethodGet, "/"+name, http.Header{"Accept-Encoding": {"gzip"}, "Range": {"bytes=0-9"}})
+	if rec.Code != http.StatusPartialContent || rec.Header().Get("Content-Encoding") != "gzip" || !bytes.Equal(rec.Body.Bytes(), raw[:10]) {
+		t.Errorf("got status %d and %q, Content-Encoding %q", rec.Code, rec.Body.Bytes(), rec.Header().Get("Content-Encoding"))
+	}
+
+	rec = serve(s, http.MethodGet, "/"+name, nil)
+	if got := rec.Body.String(); got != "archived\n" {
+		t.Errorf("got %q decompressed", got)
+	}
+}
+
+func TestFileServerAuth(t *testing.T) {
+	f := newFixture(t, rolling.Config{})
+	f.Write("line\n")
+	s := rollinghttp.NewFileServer(f.Appender, rollinghttp.FileServerConfig{Username: "admin", Password: "secret"})
+
+	if rec := serve(s, http.MethodGet, "/", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("got status %d without credentials", rec.Code)
+	}
+
+	req := http.Header{}
+	req.Set("Authorization", "Basic YWRtaW46c2VjcmV0")
+	if rec := serve(s, http.MethodGet, "/", req); rec.Code != http.StatusOK {
+		t.Errorf("got status %d with credentials", rec.Code)
+	}
+}
@@ -0,0 +1,208 @@
+// Package rollinghttp exposes the log files of a rolling appender over
+// HTTP, for internal admin ports.
+package rollinghttp
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/importcjj/rolling"
+)
+
+type handler struct {
+	appender *rolling.RollingFileAppender
+}
+
+// NewHandler returns a handler serving:
+//
+//	GET  /logs         the log file names, oldest first, as JSON
+//	GET  /logs/{name}  the content of a log file, gzipped when accepted
+//	POST /rotate       forces a rotation
+//	POST /prune        removes old files, returning their names as JSON
+//
+// Gzipped archives are sent as they are to clients accepting gzip, and
+// decompressed for the others. Mount it with http.StripPrefix to serve it below a path.
+func NewHandler(appender *rolling.RollingFileAppender) http.Handler {
+	return &handler{appender: appender}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch p := req.URL.Path; {
+	case p == "/logs" || p == "/logs/":
+		if allow(w, req, http.MethodGet) {
+			h.list(w)
+		}
+	case strings.HasPrefix(p, "/logs/"):
+		if allow(w, req, http.MethodGet) {
+			h.serveFile(w, req, strings.TrimPrefix(p, "/logs/"))
+		}
+	case p == "/rotate":
+		if allow(w, req, http.MethodPost) {
+			h.rotate(w)
+		}
+	case p == "/prune":
+		if allow(w, req, http.MethodPost) {
+			h.prune(w)
+		}
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func allow(w http.ResponseWriter, req *http.Request, method string) bool {
+	if req.Method == method {
+		return true
+	}
+
+	w.Header().Set("Allow", method)
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	return false
+}
+
+func (h *handler) list(w http.ResponseWriter) {
+	names, err := h.appender.Files()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, names)
+}
+
+func (h *handler) serveFile(w http.ResponseWriter, req *http.Request, name string) {
+	names, err := h.appender.Files()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Only names reported by the appender are served, which also keeps
+	// requests from escaping the log directory.
+	if !contains(names, name) {
+		http.NotFound(w, req)
+		return
+	}
+
+	file, err := os.Open(path.Join(h.appender.Directory(), name))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	acceptsGzip := strings.Contains(req.Header.Get("Accept-Encoding"), "gzip")
+	w.Header().Set("Vary", "Accept-Encoding")
+
+	sent := &sentWriter{w: w}
+	var src io.Reader = file
+	var dst io.Writer = sent
+	var gz *gzip.Writer
+	switch {
+	case strings.HasSuffix(name, ".gz"):
+		// Archives are sent as they are to clients taking gzip, and
+		// decompressed for the others.
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if acceptsGzip {
+			w.Header().Set("Content-Encoding", "gzip")
+			break
+		}
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer zr.Close()
+		src = zr
+
+	case strings.HasSuffix(name, ".zst") || strings.HasSuffix(name, ".enc"):
+		w.Header().Set("Content-Type", "application/octet-stream")
+
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if acceptsGzip {
+			w.Header().Set("Content-Encoding", "gzip")
+			gz = gzip.NewWriter(sent)
+			dst = gz
+		}
+	}
+
+	_, err = io.Copy(dst, src)
+	if err == nil && gz != nil {
+		err = gz.Close()
+	}
+	switch {
+	case err == nil:
+	case sent.err != nil:
+		// The client went away; there is no one left to tell.
+		log.Printf("rollinghttp: failed to send %s: %v", name, err)
+	case sent.n == 0:
+		w.Header().Del("Content-Encoding")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		// The status is out already; aborting keeps a truncated file from
+		// reaching the client as a complete response.
+		log.Printf("rollinghttp: failed to read %s: %v", name, err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// sentWriter counts the bytes written to the client and keeps the error
+// of the write that failed, telling failures to read the file apart.
+type sentWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (s *sentWriter) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	s.n += int64(n)
+	if err != nil {
+		s.err = err
+	}
+
+	return n, err
+}
+
+func (h *handler) rotate(w http.ResponseWriter) {
+	if err := h.appender.Rotate(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) prune(w http.ResponseWriter) {
+	removed, err := h.appender.Prune()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if removed == nil {
+		removed = []string{}
+	}
+	writeJSON(w, removed)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,211 @@
+package rollinghttp_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/importcjj/rolling"
+	"github.com/importcjj/rolling/rollinghttp"
+	"github.com/importcjj/rolling/rollingtest"
+)
+
+func newFixture(t *testing.T, config rolling.Config) *rollingtest.Fixture {
+	t.Helper()
+
+	config.Rotation = rolling.Hourly
+	config.FilenameSuffix = ".log"
+	config.DateFormat = "2006010215"
+
+	return rollingtest.New(t, config)
+}
+
+func serve(h http.Handler, method, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func gunzip(t *testing.T, data []byte) string {
+	t.Helper()
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+
+	plain, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(plain)
+}
+
+func decodeNames(t *testing.T, rec *httptest.ResponseRecorder) []string {
+	t.Helper()
+
+	var names []string
+	if err := json.Unmarshal(rec.Body.Bytes(), &names); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+
+	return names
+}
+
+// archive rotates the first file of f away and waits until it is
+// compressed.
+func archive(t *testing.T, f *rollingtest.Fixture) string {
+	t.Helper()
+
+	f.Clock.Advance(time.Hour)
+	f.Write("next\n")
+
+	name := "2024010100.log.gz"
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(filepath.Join(f.Dir, name)); err == nil {
+			return name
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s was not created", name)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHandlerList(t *testing.T) {
+	f := newFixture(t, rolling.Config{})
+	f.Write("line\n")
+	h := rollinghttp.NewHandler(f.Appender)
+
+	rec := serve(h, http.MethodGet, "/logs", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d", rec.Code)
+	}
+	if names := decodeNames(t, rec); len(names) != 1 || names[0] != "2024010100.log" {
+		t.Errorf("got %q", names)
+	}
+
+	if rec := serve(h, http.MethodPost, "/logs", nil); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("got status %d for POST", rec.Code)
+	}
+}
+
+func TestHandlerDownload(t *testing.T) {
+	f := newFixture(t, rolling.Config{})
+	f.Write("line\n")
+	h := rollinghttp.NewHandler(f.Appender)
+
+	rec := serve(h, http.MethodGet, "/logs/2024010100.log", nil)
+	if got := rec.Body.String(); rec.Code != http.StatusOK || got != "line\n" {
+		t.Errorf("got status %d and %q", rec.Code, got)
+	}
+
+	rec = serve(h, http.MethodGet, "/logs/2024010100.log", http.Header{"Accept-Encoding": {"gzip"}})
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("got Content-Encoding %q", rec.Header().Get("Content-Encoding"))
+	}
+	if got := gunzip(t, rec.Body.Bytes()); got != "line\n" {
+		t.Errorf("got %q gzipped", got)
+	}
+
+	for _, name := range []string{"missing.log", "../handler_test.go"} {
+		if rec := serve(h, http.MethodGet, "/logs/"+name, nil); rec.Code != http.StatusNotFound {
+			t.Errorf("got status %d for %s", rec.Code, name)
+		}
+	}
+}
+
+func TestHandlerDownloadArchive(t *testing.T) {
+	f := newFixture(t, rolling.Config{Compress: true})
+	f.Write("archived\n")
+	name := archive(t, f)
+	h := rollinghttp.NewHandler(f.Appender)
+
+	raw, err := os.ReadFile(filepath.Join(f.Dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serve(h, http.MethodGet, "/logs/"+name, http.Header{"Accept-Encoding": {"gzip"}})
+	if rec.Header().Get("Content-Encoding") != "gzip" || !bytes.Equal(rec.Body.Bytes(), raw) {
+		t.Errorf("the archive was not sent as it is")
+	}
+
+	rec = serve(h, http.MethodGet, "/logs/"+name, nil)
+	if got := rec.Body.String(); rec.Header().Get("Content-Encoding") != "" || got != "archived\n" {
+		t.Errorf("got %q, Content-Encoding %q", got, rec.Header().Get("Content-Encoding"))
+	}
+}
+
+func TestHandlerRotate(t *testing.T) {
+	f := newFixture(t, rolling.Config{})
+	f.Write("line\n")
+	h := rollinghttp.NewHandler(f.Appender)
+
+	if rec := serve(h, http.MethodPost, "/rotate", nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("got status %d", rec.Code)
+	}
+	if got := len(f.Rotations()); got != 1 {
+		t.Errorf("got %d rotations", got)
+	}
+
+	if rec := serve(h, http.MethodGet, "/rotate", nil); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("got status %d for GET", rec.Code)
+	}
+}
+
+func TestHandlerPrune(t *testing.T) {
+	f := newFixture(t, rolling.Config{MaxFiles: 1})
+	f.Write("line\n")
+	h := rollinghttp.NewHandler(f.Appender)
+
+	rec := serve(h, http.MethodPost, "/prune", nil)
+	if names := decodeNames(t, rec); rec.Code != http.StatusOK || len(names) != 0 {
+		t.Errorf("got status %d and %q with nothing to prune", rec.Code, names)
+	}
+
+	if err := os.WriteFile(filepath.Join(f.Dir, "2023123100.log"), []byte("old\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	rec = serve(h, http.MethodPost, "/prune", nil)
+	if names := decodeNames(t, rec); len(names) != 1 || names[0] != "2023123100.log" {
+		t.Errorf("got %q", names)
+	}
+	f.AssertFileCount(1)
+}
+
+// brokenConn is a response writer whose client has gone away.
+type brokenConn struct {
+	header http.Header
+}
+
+func (b *brokenConn) Header() http.Header       { return b.header }
+func (b *brokenConn) WriteHeader(int)           {}
+func (b *brokenConn) Write([]byte) (int, error) { return 0, io.ErrClosedPipe }
+
+func TestHandlerClientGone(t *testing.T) {
+	f := newFixture(t, rolling.Config{})
+	f.Write("line\n")
+	h := rollinghttp.NewHandler(f.Appender)
+
+	// A client going away is not worth aborting the handler for.
+	req := httptest.NewRequest(http.MethodGet, "/logs/2024010100.log", nil)
+	h.ServeHTTP(&brokenConn{header: http.Header{}}, req)
+}
@@ -0,0 +1,57 @@
+// Package rollingotel bridges OpenTelemetry logging to a rolling appender,
+// so that services adopting OpenTelemetry keep local rotating files as a
+// durable fallback.
+package rollingotel
+
+import (
+	"context"
+
+	"github.com/importcjj/rolling"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutlog"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+)
+
+// Exporter is an sdk/log exporter writing every record as a JSON line to
+// a rolling appender.
+type Exporter struct {
+	exporter *stdoutlog.Exporter
+	appender *rolling.RollingFileAppender
+}
+
+var _ sdklog.Exporter = (*Exporter)(nil)
+
+// NewExporter returns an exporter writing to appender. The options are
+// passed on to stdoutlog, which formats the records.
+func NewExporter(appender *rolling.RollingFileAppender, opts ...stdoutlog.Option) (*Exporter, error) {
+	opts = append([]stdoutlog.Option{stdoutlog.WithWriter(appender)}, opts...)
+
+	exporter, err := stdoutlog.New(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Exporter{exporter: exporter, appender: appender}, nil
+}
+
+func (e *Exporter) Export(ctx context.Context, records []sdklog.Record) error {
+	return e.exporter.Export(ctx, records)
+}
+
+// ForceFlush syncs the appender, so that the exported records are durable.
+func (e *Exporter) ForceFlush(ctx context.Context) error {
+	if err := e.exporter.ForceFlush(ctx); err != nil {
+		return err
+	}
+
+	return e.appender.Sync()
+}
+
+// Shutdown stops the exporter and syncs the appender. The appender is
+// left open, as it may be shared with other writers.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	if err := e.exporter.Shutdown(ctx); err != nil {
+		return err
+	}
+
+	return e.appender.Sync()
+}
@@ -0,0 +1,26 @@
+module github.com/importcjj/rolling/rollingotel
+
+go 1.21
+
+require (
+	github.com/importcjj/rolling v0.0.0-00010101000000-000000000000
+	go.opentelemetry.io/otel/exporters/stdout/stdoutlog v0.5.0
+	go.opentelemetry.io/otel/sdk/log v0.5.0
+)
+
+require (
+	github.com/djherbis/times v1.5.0 // indirect
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	go.opentelemetry.io/otel v1.29.0 // indirect
+	go.opentelemetry.io/otel/log v0.5.0 // indirect
+	go.opentelemetry.io/otel/metric v1.29.0 // indirect
+	go.opentelemetry.io/otel/sdk v1.29.0 // indirect
+	go.opentelemetry.io/otel/trace v1.29.0 // indirect
+	golang.org/x/sys v0.24.0 // indirect
+)
+
+// Until a release has the API the exporter uses, it builds against the
+// repository it lives in.
+replace github.com/importcjj/rolling => ../
@@ -0,0 +1,163 @@
+// Package rollingtest helps testing code that logs through a rolling
+// appender, with a controllable clock and a temporary log directory.
+package rollingtest
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/importcjj/rolling"
+)
+
+// Start is the time a fixture's clock starts at unless Config.Clock is a
+// *Clock already.
+var Start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Clock is a rolling.Clock that only moves when told to.
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *Clock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = now
+}
+
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// Fixture is an appender writing to a temporary directory, with its clock
+// and a record of its rotations.
+type Fixture struct {
+	T        testing.TB
+	Dir      string
+	Clock    *Clock
+	Appender *rolling.RollingFileAppender
+
+	mu        sync.Mutex
+	rotations []time.Time
+}
+
+// New creates an appender for config in a temporary directory, which is
+// removed with the appender closed when the test ends. Files are ordered
+// by the dates in their names, as with Config.DisableBirthTime.
+func New(t testing.TB, config rolling.Config) *Fixture {
+	t.Helper()
+
+	f := &Fixture{T: t, Dir: t.TempDir()}
+
+	clock, ok := config.Clock.(*Clock)
+	if !ok {
+		clock = NewClock(Start)
+	}
+	f.Clock = clock
+
+	onRotate := config.OnRotate
+	config.Directory = f.Dir
+	config.Clock = clock
+	// Birth times follow the real clock, not the fixture's, and are not
+	// available everywhere; the dates in the names are.
+	config.DisableBirthTime = true
+	config.OnRotate = func(file rolling.FileInfo) {
+		f.mu.Lock()
+		f.rotations = append(f.rotations, clock.Now())
+		f.mu.Unlock()
+
+		if onRotate != nil {
+			onRotate(file)
+		}
+	}
+
+	appender, err := rolling.New(config)
+	if err != nil {
+		t.Fatalf("rolling.New: %v", err)
+	}
+	f.Appender = appender
+	t.Cleanup(func() { appender.Close() })
+
+	return f
+}
+
+// Write writes s to the appender, failing the test on error.
+func (f *Fixture) Write(s string) {
+	f.T.Helper()
+
+	if _, err := f.Appender.Write([]byte(s)); err != nil {
+		f.T.Fatalf("write: %v", err)
+	}
+}
+
+// Files returns the appender's files, oldest first.
+func (f *Fixture) Files() []string {
+	f.T.Helper()
+
+	names, err := f.Appender.Files()
+	if err != nil {
+		f.T.Fatalf("list files: %v", err)
+	}
+
+	return names
+}
+
+// Read returns the content of the named log file.
+func (f *Fixture) Read(name string) string {
+	f.T.Helper()
+
+	data, err := os.ReadFile(filepath.Join(f.Dir, filepath.FromSlash(name)))
+	if err != nil {
+		f.T.Fatalf("read %s: %v", name, err)
+	}
+
+	return string(data)
+}
+
+// Rotations returns the clock times at which rotations completed.
+func (f *Fixture) Rotations() []time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]time.Time(nil), f.rotations...)
+}
+
+func (f *Fixture) AssertFileCount(n int) {
+	f.T.Helper()
+
+	if names := f.Files(); len(names) != n {
+		f.T.Errorf("got %d log files %q, want %d", len(names), names, n)
+	}
+}
+
+// AssertRotatedAt checks that a rotation completed at the clock time at.
+func (f *Fixture) AssertRotatedAt(at time.Time) {
+	f.T.Helper()
+
+	rotations := f.Rotations()
+	for _, t := range rotations {
+		if t.Equal(at) {
+			return
+		}
+	}
+
+	f.T.Errorf("no rotation at %v, rotations: %v", at, rotations)
+}
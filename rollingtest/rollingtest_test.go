@@ -0,0 +1,42 @@
+package rollingtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/importcjj/rolling"
+)
+
+func TestFixtureRotatesWithClock(t *testing.T) {
+	f := New(t, rolling.Config{Rotation: rolling.Hourly})
+
+	f.Write("first\n")
+	f.AssertFileCount(1)
+
+	f.Clock.Advance(time.Hour)
+	f.Write("second\n")
+
+	f.AssertFileCount(2)
+	f.AssertRotatedAt(Start.Add(time.Hour))
+
+	files := f.Files()
+	if got := f.Read(files[0]); got != "first\n" {
+		t.Errorf("first file: got %q", got)
+	}
+	if got := f.Read(files[1]); got != "second\n" {
+		t.Errorf("second file: got %q", got)
+	}
+}
+
+func TestClock(t *testing.T) {
+	c := NewClock(Start)
+	c.Advance(time.Minute)
+	if want := Start.Add(time.Minute); !c.Now().Equal(want) {
+		t.Errorf("after Advance: got %v, want %v", c.Now(), want)
+	}
+
+	c.Set(Start)
+	if !c.Now().Equal(Start) {
+		t.Errorf("after Set: got %v, want %v", c.Now(), Start)
+	}
+}
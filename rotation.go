@@ -1,29 +1,136 @@
 package rolling
 
-import "time"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
 type Rotation interface {
 	NextDate(current time.Time) *time.Time
 }
 
+// PeriodicRotation is implemented by rotations with fixed periods. Round
+// returns the start of the period containing t, so that a timestamp can be
+// mapped to its file.
+type PeriodicRotation interface {
+	Rotation
+	Round(t time.Time) time.Time
+}
+
 var (
-	Never    = newRotation(0)
-	Minutely = newRotation(1)
-	Hourly   = newRotation(2)
-	Daily    = newRotation(3)
+	Never     = newRotation(0)
+	Minutely  = newRotation(1)
+	Hourly    = newRotation(2)
+	Daily     = newRotation(3)
+	ISOWeekly = newRotation(4)
+	Yearly    = newRotation(5)
+	Secondly  = newRotation(6)
 )
 
 type RotationKind int8
 
 type rotation struct {
-	kind RotationKind
+	kind  RotationKind
+	every time.Duration
 }
 
 func newRotation(kind RotationKind) Rotation {
-	return rotation{kind}
+	return rotation{kind: kind}
+}
+
+// Every rotates at every multiple of d, which may be shorter than a
+// second, e.g. for tests and short-lived batch jobs. Boundaries are
+// aligned as by time.Time.Truncate.
+func Every(d time.Duration) Rotation {
+	if d <= 0 {
+		return Never
+	}
+
+	return rotation{kind: 7, every: d}
+}
+
+var rotationNames = map[RotationKind]string{
+	0: "never",
+	1: "minutely",
+	2: "hourly",
+	3: "daily",
+	4: "isoweekly",
+	5: "yearly",
+	6: "secondly",
+}
+
+// ParseRotation returns the rotation named by s, as returned by the String
+// method of the built-in rotations: a name such as "daily", a duration
+// such as "30s" for Every, or "age:" and a duration for AgeRotation.
+func ParseRotation(s string) (Rotation, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for kind, name := range rotationNames {
+		if s == name {
+			return newRotation(kind), nil
+		}
+	}
+
+	if maxAge := strings.TrimPrefix(s, "age:"); maxAge != s {
+		d, err := time.ParseDuration(maxAge)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("rolling: invalid rotation %q", s)
+		}
+		return AgeRotation(d), nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return nil, fmt.Errorf("rolling: unknown rotation %q", s)
+	}
+
+	return Every(d), nil
+}
+
+func (r rotation) String() string {
+	if r.kind == 7 {
+		return r.every.String()
+	}
+
+	return rotationNames[r.kind]
+}
+
+// Period returns the nominal length of a period: years are 365 days and
+// days are 24 hours, regardless of leap years and DST changes.
+func (r rotation) Period() time.Duration {
+	switch r.kind {
+	case 1:
+		return time.Minute
+	case 2:
+		return time.Hour
+	case 3:
+		return 24 * time.Hour
+	case 4:
+		return 7 * 24 * time.Hour
+	case 5:
+		return 365 * 24 * time.Hour
+	case 6:
+		return time.Second
+	case 7:
+		return r.every
+	}
+
+	return 0
 }
 
 func (r rotation) NextDate(current time.Time) *time.Time {
+	date := r.nextWindow(current)
+	if date == nil {
+		return nil
+	}
+
+	roundDate := r.roundDate(*date)
+	return &roundDate
+}
+
+// nextWindow returns the end of a full period starting at current, without
+// aligning it to the clock.
+func (r rotation) nextWindow(current time.Time) *time.Time {
 	var date time.Time
 	switch r.kind {
 	case 1:
@@ -32,12 +139,29 @@ func (r rotation) NextDate(current time.Time) *time.Time {
 		date = current.Add(time.Hour)
 	case 3:
 		date = current.AddDate(0, 0, 1)
+	case 4:
+		date = current.AddDate(0, 0, 7)
+	case 5:
+		date = current.AddDate(1, 0, 0)
+	case 6:
+		date = current.Add(time.Second)
+	case 7:
+		date = current.Add(r.every)
 	default:
 		return nil
 	}
 
-	roundDate := r.roundDate(date)
-	return &roundDate
+	return &date
+}
+
+// Round returns the start of the period containing t. Never has a single
+// unbounded period, for which it returns the zero time.
+func (r rotation) Round(t time.Time) time.Time {
+	if r.kind == 0 {
+		return time.Time{}
+	}
+
+	return r.roundDate(t)
 }
 
 func (r rotation) roundDate(date time.Time) time.Time {
@@ -48,7 +172,79 @@ func (r rotation) roundDate(date time.Time) time.Time {
 	case 2:
 		return time.Date(date.Year(), date.Month(), date.Day(), date.Hour(), 0, 0, 0, date.Location())
 	case 3:
-		return time.Date(date.Year(), date.Month(), date.Day(), date.Hour(), 0, 0, 0, date.Location())
+		return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+	case 4:
+		// ISO weeks start on Monday.
+		offset := (int(date.Weekday()) + 6) % 7
+		return time.Date(date.Year(), date.Month(), date.Day()-offset, 0, 0, 0, 0, date.Location())
+	case 5:
+		return time.Date(date.Year(), 1, 1, 0, 0, 0, 0, date.Location())
+	case 6:
+		return time.Date(date.Year(), date.Month(), date.Day(), date.Hour(), date.Minute(), date.Second(), 0, date.Location())
+	case 7:
+		return date.Truncate(r.every)
 	}
 	panic("unreachable")
 }
+
+// NextBoundary returns the time after t at which an appender with rotation
+// r rotates, in the location of t, or the zero time when r never rotates.
+// With AnchorToFirstWrite, boundaries are measured from the first write
+// of each file instead.
+func NextBoundary(r Rotation, t time.Time) time.Time {
+	if r == nil {
+		return time.Time{}
+	}
+
+	if next := r.NextDate(t); next != nil {
+		return *next
+	}
+
+	return time.Time{}
+}
+
+// PeriodOf returns the bounds of the period of rotation r containing t, in
+// the location of t. Both are zero for Never and for rotations without
+// fixed periods, such as AgeRotation.
+func PeriodOf(r Rotation, t time.Time) (start, end time.Time) {
+	p, ok := r.(PeriodicRotation)
+	if !ok || r == Never {
+		return time.Time{}, time.Time{}
+	}
+
+	start = p.Round(t)
+	return start, NextBoundary(r, start)
+}
+
+// windowRotation is implemented by rotations that can measure a period
+// from an arbitrary start, as used by Config.AnchorToFirstWrite.
+type windowRotation interface {
+	nextWindow(current time.Time) *time.Time
+}
+
+type ageRotation struct {
+	maxAge time.Duration
+}
+
+// AgeRotation rotates a file once it has been open for maxAge, measured
+// from its creation rather than from clock-aligned boundaries.
+func AgeRotation(maxAge time.Duration) Rotation {
+	return ageRotation{maxAge}
+}
+
+func (r ageRotation) String() string {
+	return "age:" + r.maxAge.String()
+}
+
+func (r ageRotation) Period() time.Duration {
+	return r.maxAge
+}
+
+func (r ageRotation) NextDate(current time.Time) *time.Time {
+	if r.maxAge <= 0 {
+		return nil
+	}
+
+	date := current.Add(r.maxAge)
+	return &date
+}
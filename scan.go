@@ -0,0 +1,108 @@
+package rolling
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"time"
+)
+
+// Scan calls fn with every line, without its newline, of the log files
+// whose periods overlap from to to, in time order. Files compressed with
+// gzip are read too; other archives are skipped. A zero from or to leaves
+// that side open. The line is only valid during the call. Scan stops at
+// the first error returned by fn, and when ctx is done.
+func (r *RollingFileAppender) Scan(ctx context.Context, fn func(file FileInfo, line []byte) error, from, to time.Time) error {
+	var files []FileInfo
+	if err := r.state.walkLogs(func(name string) {
+		if stem, archived := trimArchiveExt(name); archived && name != stem+".gz" {
+			return
+		}
+
+		file := r.state.fileInfo(name)
+		if !to.IsZero() && !file.PeriodStart.IsZero() && !file.PeriodStart.Before(to) {
+			return
+		}
+		if !from.IsZero() && !file.PeriodEnd.IsZero() && !file.PeriodEnd.After(from) {
+			return
+		}
+		files = append(files, file)
+	}); err != nil {
+		return err
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		if !files[i].PeriodStart.Equal(files[j].PeriodStart) {
+			return files[i].PeriodStart.Before(files[j].PeriodStart)
+		}
+		return files[i].Sequence < files[j].Sequence
+	})
+
+	for _, file := range files {
+		if err := scanFile(ctx, file, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func scanFile(ctx context.Context, file FileInfo, fn func(FileInfo, []byte) error) error {
+	f, err := os.Open(file.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Pruned in the meantime.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var rd io.Reader = f
+	if file.Compressed {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		rd = gz
+	}
+
+	br := bufio.NewReader(rd)
+	var line []byte
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		chunk, err := br.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			// A line longer than the buffer.
+			line = append(line, chunk...)
+			continue
+		}
+		if len(line) > 0 {
+			chunk = append(line, chunk...)
+			line = line[:0]
+		}
+
+		if len(chunk) > 0 {
+			if cbErr := fn(file, bytes.TrimSuffix(chunk, newline)); cbErr != nil {
+				return cbErr
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package rolling
+
+import (
+	"os"
+	"sync"
+)
+
+// RedirectStdio sends the process's own stdout and stderr to the appender
+// through a pipe, so that the output of C libraries and of panics is
+// captured along with the log. On Unix descriptors 1 and 2 are pointed at
+// the pipe; elsewhere only os.Stdout and os.Stderr are replaced. Errors of
+// the appender itself keep going to the original stderr. restore points
+// stdout and stderr back and waits until the pipe has been drained.
+func (r *RollingFileAppender) RedirectStdio() (restore func() error, err error) {
+	w, done, err := r.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, stderr := os.Stdout, os.Stderr
+	saved, err := redirectFds(w, []*os.File{stdout, stderr})
+	if err != nil {
+		w.Close()
+		done()
+		return nil, err
+	}
+
+	// The originals are kept for restoring, and for the errors of the
+	// appender, which would otherwise feed back into the pipe.
+	original := stderr
+	if saved != nil {
+		original = saved[1]
+	} else {
+		os.Stdout, os.Stderr = w, w
+	}
+	r.state.stderr.Store(original)
+
+	var once sync.Once
+	var restoreErr error
+	restore = func() error {
+		once.Do(func() {
+			if saved != nil {
+				restoreErr = restoreFds(saved, []*os.File{stdout, stderr})
+			} else {
+				os.Stdout, os.Stderr = stdout, stderr
+			}
+			r.state.stderr.Store(nil)
+
+			if err := done(); restoreErr == nil {
+				restoreErr = err
+			}
+		})
+		return restoreErr
+	}
+
+	return restore, nil
+}
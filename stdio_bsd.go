@@ -0,0 +1,10 @@
+//go:build !linux && !windows && !plan9
+// +build !linux,!windows,!plan9
+
+package rolling
+
+import "syscall"
+
+func dup2(oldfd, newfd int) error {
+	return syscall.Dup2(oldfd, newfd)
+}
@@ -0,0 +1,16 @@
+//go:build linux
+// +build linux
+
+package rolling
+
+import "syscall"
+
+// dup2 is built on Dup3, since some Linux architectures lack the dup2
+// system call.
+func dup2(oldfd, newfd int) error {
+	if oldfd == newfd {
+		return nil
+	}
+
+	return syscall.Dup3(oldfd, newfd, 0)
+}
@@ -0,0 +1,16 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package rolling
+
+import "os"
+
+// redirectFds leaves the descriptors alone: RedirectStdio replaces
+// os.Stdout and os.Stderr instead.
+func redirectFds(w *os.File, files []*os.File) ([]*os.File, error) {
+	return nil, nil
+}
+
+func restoreFds(saved, files []*os.File) error {
+	return nil
+}
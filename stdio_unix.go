@@ -0,0 +1,45 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package rolling
+
+import (
+	"os"
+	"syscall"
+)
+
+// redirectFds points the descriptors of files at w, returning duplicates
+// of the descriptors they had.
+func redirectFds(w *os.File, files []*os.File) ([]*os.File, error) {
+	saved := make([]*os.File, 0, len(files))
+	for _, file := range files {
+		fd, err := syscall.Dup(int(file.Fd()))
+		if err != nil {
+			restoreFds(saved, files)
+			return nil, err
+		}
+		syscall.CloseOnExec(fd)
+		saved = append(saved, os.NewFile(uintptr(fd), file.Name()))
+
+		if err := dup2(int(w.Fd()), int(file.Fd())); err != nil {
+			restoreFds(saved, files)
+			return nil, err
+		}
+	}
+
+	return saved, nil
+}
+
+// restoreFds points the descriptors of files back at those saved by
+// redirectFds, and closes the duplicates.
+func restoreFds(saved, files []*os.File) error {
+	var first error
+	for i, dup := range saved {
+		if err := dup2(int(dup.Fd()), int(files[i].Fd())); err != nil && first == nil {
+			first = err
+		}
+		dup.Close()
+	}
+
+	return first
+}
@@ -0,0 +1,15 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package rolling
+
+import (
+	"io"
+	"log/syslog"
+)
+
+// NewSyslogMirror connects to the local syslog daemon and returns a writer
+// suitable for Config.Mirror. Records are logged with LOG_INFO|LOG_USER.
+func NewSyslogMirror(tag string) (io.WriteCloser, error) {
+	return syslog.New(syslog.LOG_INFO|syslog.LOG_USER, tag)
+}
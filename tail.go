@@ -0,0 +1,131 @@
+package rolling
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+)
+
+const tailBlockSize = 64 * 1024
+
+// TailBytes returns the last n bytes written, reading back from the
+// current file into the previous ones. Compressed files are skipped.
+func (r *RollingFileAppender) TailBytes(n int64) ([]byte, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	buf, err := r.tail(func(buf []byte) bool {
+		return int64(len(buf)) >= n
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(buf)) > n {
+		buf = buf[int64(len(buf))-n:]
+	}
+
+	return buf, nil
+}
+
+// TailLines is TailBytes for the last n lines.
+func (r *RollingFileAppender) TailLines(n int) ([]byte, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	buf, err := r.tail(func(buf []byte) bool {
+		return bytes.Count(bytes.TrimSuffix(buf, newline), newline) >= n
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Cut after the newline ending the line before the last n.
+	end := len(bytes.TrimSuffix(buf, newline))
+	for i := 0; i < n; i++ {
+		end = bytes.LastIndexByte(buf[:end], '\n')
+		if end < 0 {
+			return buf, nil
+		}
+	}
+
+	return buf[end+1:], nil
+}
+
+// tail reads the files backwards, newest first, until done is satisfied
+// with the data read so far.
+func (r *RollingFileAppender) tail(done func(buf []byte) bool) ([]byte, error) {
+	names, err := r.recentFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf []byte
+	for _, name := range names {
+		file, err := os.Open(path.Join(r.state.logDirectory, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			// Pruned in the meantime.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		for off := info.Size(); off > 0; {
+			size := int64(tailBlockSize)
+			if off < size {
+				size = off
+			}
+			off -= size
+
+			block := make([]byte, size)
+			if _, err := file.ReadAt(block, off); err != nil {
+				file.Close()
+				return nil, err
+			}
+
+			buf = append(block, buf...)
+			if done(buf) {
+				file.Close()
+				return buf, nil
+			}
+		}
+		file.Close()
+	}
+
+	return buf, nil
+}
+
+// recentFiles returns the uncompressed log files, the active one first and
+// then from the newest to the oldest.
+func (r *RollingFileAppender) recentFiles() ([]string, error) {
+	h := r.file.Load()
+	if h == nil {
+		return nil, os.ErrClosed
+	}
+	active := h.name
+
+	files, err := r.state.listLogs()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{active}
+	for i := len(files) - 1; i >= 0; i-- {
+		if _, archived := trimArchiveExt(files[i].Name); !archived && files[i].Name != active {
+			names = append(names, files[i].Name)
+		}
+	}
+
+	return names, nil
+}
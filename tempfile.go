@@ -0,0 +1,67 @@
+package rolling
+
+import (
+	"os"
+	"path"
+	"strings"
+)
+
+// TempFileMode selects when new files get their name, so that collectors
+// globbing for log files never pick up one that is still being set up.
+type TempFileMode int8
+
+const (
+	TempFilesOff TempFileMode = iota
+	// RenameOnFirstWrite creates files under their name followed by ".tmp"
+	// and renames them once the first bytes are written.
+	RenameOnFirstWrite
+	// RenameOnRotate keeps the active file under its temporary name until
+	// it is rotated away from or the appender is closed. CurrentFilename
+	// still returns the final name.
+	RenameOnRotate
+)
+
+const tempExt = ".tmp"
+
+func (s *state) isTemp(filename string) bool {
+	return s.tempFiles != TempFilesOff && strings.HasSuffix(filename, tempExt)
+}
+
+// currentPath returns the path of the file of h, under its temporary name
+// until it is committed.
+func (h *fileHandle) currentPath() string {
+	name := path.Join(h.state.logDirectory, h.name)
+	if h.temp.Load() {
+		return name + tempExt
+	}
+
+	return name
+}
+
+// commitTemp renames the temporary file of h to its name.
+func (h *fileHandle) commitTemp() {
+	if !h.temp.CompareAndSwap(true, false) {
+		return
+	}
+
+	name := path.Join(h.state.logDirectory, h.name)
+	if err := os.Rename(name+tempExt, name); err != nil {
+		h.state.logError("failed to rename the temporary log file", err, "file", h.name)
+		return
+	}
+	h.state.indexCreated(h.name)
+
+	if h.state.syncDir {
+		if err := syncDir(path.Dir(name)); err != nil {
+			h.state.logError("failed to sync the log directory", err)
+		}
+	}
+}
+
+// wrote commits the temporary file of h once n bytes have been written to
+// it with RenameOnFirstWrite.
+func (h *fileHandle) wrote(n int) {
+	if n > 0 && h.temp.Load() && h.state.tempFiles == RenameOnFirstWrite {
+		h.commitTemp()
+	}
+}
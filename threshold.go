@@ -0,0 +1,68 @@
+package rolling
+
+// ThresholdKind tells which soft limit a Threshold crossed.
+type ThresholdKind int
+
+const (
+	// ThresholdFileSize is crossed by the active file growing past
+	// SoftMaxFileSize.
+	ThresholdFileSize ThresholdKind = iota
+	// ThresholdFiles is crossed by the log files outnumbering SoftMaxFiles.
+	ThresholdFiles
+)
+
+func (k ThresholdKind) String() string {
+	if k == ThresholdFiles {
+		return "files"
+	}
+
+	return "file size"
+}
+
+// Threshold is passed to OnThreshold when a soft limit is crossed.
+type Threshold struct {
+	Kind ThresholdKind
+	// Value is the size of the file or the number of files, Limit the soft
+	// limit it went over.
+	Value int64
+	Limit int64
+	// File is the active file for ThresholdFileSize, and the file just
+	// rotated away from for ThresholdFiles.
+	File FileInfo
+}
+
+// checkSoftSize reports the first write taking h past SoftMaxFileSize.
+func (s *state) checkSoftSize(h *fileHandle) {
+	if s.softMaxFileSize <= 0 || s.onThreshold == nil {
+		return
+	}
+
+	size := h.size.Load()
+	if size <= s.softMaxFileSize || h.overSoftSize.Swap(true) {
+		return
+	}
+
+	s.threshold(Threshold{Kind: ThresholdFileSize, Value: size, Limit: s.softMaxFileSize, File: s.fileInfo(h.name)})
+}
+
+// checkSoftFiles reports the rotations leaving more than SoftMaxFiles
+// files.
+func (s *state) checkSoftFiles(rotated string) {
+	if s.softMaxFiles <= 0 || s.onThreshold == nil {
+		return
+	}
+
+	files, err := s.listLogs()
+	if err != nil || len(files) <= s.softMaxFiles {
+		return
+	}
+
+	s.threshold(Threshold{Kind: ThresholdFiles, Value: int64(len(files)), Limit: int64(s.softMaxFiles), File: s.fileInfo(rotated)})
+}
+
+// threshold calls OnThreshold on a goroutine of its own, so that it may
+// log to the appender.
+func (s *state) threshold(t Threshold) {
+	s.logWarning("crossed a soft limit", "limit", t.Kind.String(), "value", t.Value, "threshold", t.Limit)
+	go s.onThreshold(t)
+}
@@ -0,0 +1,202 @@
+package rolling
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	uploadMinBackoff = time.Second
+	uploadMaxBackoff = time.Minute
+)
+
+// uploader ships rotated files with Config.Upload, one at a time and in
+// rotation order. The files waiting for upload are persisted in the queue
+// file, so that they are shipped after a restart too, and pruning leaves
+// them alone.
+type uploader struct {
+	s         *state
+	upload    func(ctx context.Context, file FileInfo) error
+	queuePath string
+
+	mu     sync.Mutex
+	queue  []string
+	queued map[string]bool
+
+	wake   chan struct{}
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (s *state) uploadQueueFilename() string {
+	return s.logFilenamePrefix + "upload-queue" + s.logFilenameSuffix
+}
+
+func newUploader(s *state, upload func(context.Context, FileInfo) error) (*uploader, error) {
+	u := &uploader{
+		s:         s,
+		upload:    upload,
+		queuePath: path.Join(s.logDirectory, s.uploadQueueFilename()),
+		queued:    make(map[string]bool),
+		wake:      make(chan struct{}, 1),
+	}
+
+	content, err := os.ReadFile(u.queuePath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		if name := scanner.Text(); len(name) > 0 && !u.queued[name] {
+			u.queue = append(u.queue, name)
+			u.queued[name] = true
+		}
+	}
+
+	return u, nil
+}
+
+func (u *uploader) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	u.cancel = cancel
+	u.done = make(chan struct{})
+
+	go u.run(ctx)
+}
+
+// stop cancels the upload in progress and waits for it. The files left in
+// the queue are shipped on the next start.
+func (u *uploader) stop() {
+	if u.cancel == nil {
+		return
+	}
+
+	u.cancel()
+	<-u.done
+}
+
+func (u *uploader) enqueue(name string) {
+	u.mu.Lock()
+	if !u.queued[name] {
+		u.queue = append(u.queue, name)
+		u.queued[name] = true
+		u.persist()
+	}
+	u.mu.Unlock()
+
+	select {
+	case u.wake <- struct{}{}:
+	default:
+	}
+}
+
+// MayDelete keeps the files waiting for upload.
+func (u *uploader) MayDelete(p string) bool {
+	rel, err := filepath.Rel(u.s.logDirectory, p)
+	if err != nil {
+		return true
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return !u.queued[filepath.ToSlash(rel)]
+}
+
+func (u *uploader) next() (string, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if len(u.queue) == 0 {
+		return "", false
+	}
+
+	return u.queue[0], true
+}
+
+func (u *uploader) shipped(name string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.queue = u.queue[1:]
+	delete(u.queued, name)
+	u.persist()
+}
+
+func (u *uploader) run(ctx context.Context) {
+	defer close(u.done)
+
+	backoff := uploadMinBackoff
+	for {
+		name, ok := u.next()
+		if !ok {
+			select {
+			case <-u.wake:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		info := u.s.fileInfo(name)
+		if _, err := os.Stat(info.Path); errors.Is(err, fs.ErrNotExist) {
+			u.shipped(name)
+			continue
+		}
+
+		err := u.upload(ctx, info)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err == nil {
+			u.shipped(name)
+			u.s.logEvent("uploaded the log file", "file", name)
+			if !u.s.pruneSpared(name) && u.s.compressor != nil {
+				u.s.compressor.enqueue(u.s, name)
+			}
+			backoff = uploadMinBackoff
+			continue
+		}
+
+		u.s.logError("failed to upload the log file", err, "file", name)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		if backoff *= 2; backoff > uploadMaxBackoff {
+			backoff = uploadMaxBackoff
+		}
+	}
+}
+
+// persist replaces the queue file with the current queue. The caller holds
+// mu.
+func (u *uploader) persist() {
+	if len(u.queue) == 0 {
+		if err := os.Remove(u.queuePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			u.s.logError("failed to update the upload queue", err)
+		}
+		return
+	}
+
+	var b bytes.Buffer
+	for _, name := range u.queue {
+		b.WriteString(name)
+		b.WriteByte('\n')
+	}
+
+	if err := writeFileAtomic(u.queuePath, b.Bytes(), u.s.fileMode); err != nil {
+		u.s.logError("failed to update the upload queue", err)
+	}
+}
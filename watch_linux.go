@@ -0,0 +1,104 @@
+package rolling
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const watchMask = syscall.IN_MOVE_SELF | syscall.IN_DELETE_SELF | syscall.IN_ATTRIB
+
+// watcher reopens the active file when another program renames or removes
+// it, as logrotate or a sidecar may do.
+type watcher struct {
+	r    *RollingFileAppender
+	fd   int
+	file *os.File
+
+	mu     sync.Mutex
+	wd     int
+	handle *fileHandle
+}
+
+func newWatcher(r *RollingFileAppender) (*watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+
+	// A non-blocking descriptor is handed to the runtime poller, so that
+	// closing the file unblocks the reader.
+	w := &watcher{r: r, fd: fd, file: os.NewFile(uintptr(fd), "inotify"), wd: -1}
+	if h := r.file.Load(); h != nil {
+		w.watch(h)
+	}
+
+	go w.run()
+
+	return w, nil
+}
+
+func (w *watcher) watch(h *fileHandle) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.wd >= 0 {
+		syscall.InotifyRmWatch(w.fd, uint32(w.wd))
+		w.wd = -1
+	}
+
+	wd, err := syscall.InotifyAddWatch(w.fd, h.currentPath(), watchMask)
+	if err != nil {
+		w.r.state.logError("failed to watch the log file", err)
+		return
+	}
+
+	w.wd = wd
+	w.handle = h
+}
+
+func (w *watcher) run() {
+	buf := make([]byte, 4096)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			return
+		}
+
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			off += syscall.SizeofInotifyEvent + int(event.Len)
+
+			w.mu.Lock()
+			h := w.handle
+			current := int(event.Wd) == w.wd
+			w.mu.Unlock()
+
+			if current && event.Mask&watchMask != 0 && !w.stillInPlace(h) {
+				w.r.reopen(h)
+			}
+		}
+	}
+}
+
+// stillInPlace reports whether the path of h still refers to its file,
+// which its own rename from the temporary name does not change. Attribute
+// changes are reported for chmod as well as for unlinking.
+func (w *watcher) stillInPlace(h *fileHandle) bool {
+	current, err := os.Stat(h.currentPath())
+	if err != nil {
+		return false
+	}
+
+	opened, err := h.file.Stat()
+	if err != nil {
+		return false
+	}
+
+	return os.SameFile(current, opened)
+}
+
+func (w *watcher) close() error {
+	return w.file.Close()
+}
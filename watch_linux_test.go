@@ -0,0 +1,145 @@
+package rolling_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/importcjj/rolling"
+	"github.com/importcjj/rolling/rollingtest"
+)
+
+func TestWatchIgnoresTempFileCommit(t *testing.T) {
+	f := rollingtest.New(t, rolling.Config{
+		Rotation:              rolling.Never,
+		FilenamePrefix:        "app.log",
+		TempFiles:             rolling.RenameOnFirstWrite,
+		WatchExternalRotation: true,
+	})
+	generation := f.Appender.Generation()
+
+	f.Write("first\n")
+	// Give the watcher time to see the rename.
+	time.Sleep(100 * time.Millisecond)
+	f.Write("second\n")
+
+	if got := f.Appender.Generation(); got != generation {
+		t.Errorf("generation went from %d to %d after committing the temporary file", generation, got)
+	}
+	if got := f.Read("app.log"); got != "first\nsecond\n" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestWatchReopensAfterExternalRename(t *testing.T) {
+	f := rollingtest.New(t, rolling.Config{
+		Rotation:              rolling.Never,
+		FilenamePrefix:        "app.log",
+		WatchExternalRotation: true,
+	})
+	f.Write("before\n")
+
+	if err := os.Rename(filepath.Join(f.Dir, "app.log"), filepath.Join(f.Dir, "app.log.old")); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(filepath.Join(f.Dir, "app.log")); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the file was not reopened")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	f.Write("after\n")
+
+	if got := f.Read("app.log"); got != "after\n" {
+		t.Errorf("got %q in the reopened file", got)
+	}
+}
+
+func TestWatchReleasesReopenedFiles(t *testing.T) {
+	files := &openFiles{}
+	f := rollingtest.New(t, rolling.Config{
+		Rotation:              rolling.Never,
+		FilenamePrefix:        "app.log",
+		WatchExternalRotation: true,
+		OpenFileFunc:          files.open,
+	})
+
+	var written atomic.Int64
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; ; j++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if _, err := fmt.Fprintf(f.Appender, "%d-%d\n", i, j); err != nil {
+					t.Error(err)
+					return
+				}
+				written.Add(1)
+			}
+		}(i)
+	}
+
+	generation := f.Appender.Generation()
+	for i := 0; i < 3; i++ {
+		time.Sleep(10 * time.Millisecond)
+		if err := os.Rename(filepath.Join(f.Dir, "app.log"), filepath.Join(f.Dir, fmt.Sprintf("moved.%d", i))); err != nil {
+			t.Fatal(err)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for f.Appender.Generation() == generation {
+			if time.Now().After(deadline) {
+				t.Fatal("the file was not reopened")
+			}
+			time.Sleep(time.Millisecond)
+		}
+		generation = f.Appender.Generation()
+	}
+	close(stop)
+	wg.Wait()
+
+	// Only the active file is still open, once the watcher has released
+	// the last one it replaced.
+	deadline := time.Now().Add(5 * time.Second)
+	for open := files.stillOpen(); len(open) != 1 || filepath.Base(open[0]) != "app.log"; open = files.stillOpen() {
+		if time.Now().After(deadline) {
+			t.Fatalf("files open: %q", open)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := f.Appender.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if open := files.stillOpen(); len(open) > 0 {
+		t.Errorf("files left open after Close: %q", open)
+	}
+
+	var lines int64
+	entries, err := os.ReadDir(f.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		lines += int64(strings.Count(f.Read(entry.Name()), "\n"))
+	}
+	if lines != written.Load() {
+		t.Errorf("got %d records, want %d", lines, written.Load())
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package rolling
+
+type watcher struct{}
+
+func newWatcher(r *RollingFileAppender) (*watcher, error) {
+	return nil, ErrWatchUnsupported
+}
+
+func (w *watcher) watch(h *fileHandle) {}
+
+func (w *watcher) close() error {
+	return nil
+}